@@ -0,0 +1,17 @@
+package domain
+
+// AudioEncoding of synthesized speech, both are 8kHz mono
+type AudioEncoding string
+
+const (
+	// AudioMuLaw is G.711 μ-law, what Twilio media streams play
+	AudioMuLaw AudioEncoding = "audio/x-mulaw"
+	// AudioPCM16 is signed 16 bit little endian PCM
+	AudioPCM16 AudioEncoding = "audio/l16"
+)
+
+// AudioChunk is a piece of synthesized speech
+type AudioChunk struct {
+	Encoding AudioEncoding
+	Data     []byte
+}
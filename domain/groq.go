@@ -1,5 +1,10 @@
 package domain
 
+import (
+	"encoding/json"
+	"strings"
+)
+
 // Struct representing the JSON structure
 type ChatCompletion struct {
 	ID                string   `json:"id"`
@@ -20,8 +25,37 @@ type Choice struct {
 }
 
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role        string     `json:"role"`
+	Content     string     `json:"content"`
+	ToolCalls   []ToolCall `json:"tool_calls,omitempty"`   // tools the assistant asked to run
+	ToolCallID  string     `json:"tool_call_id,omitempty"` // set on "tool" messages carrying a result
+	Name        string     `json:"name,omitempty"`
+	Interrupted bool       `json:"-"` // assistant turn was cut off by the caller
+}
+
+// Tool describes a function the LLM may call, Parameters is a JSON schema
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a function call requested by the LLM, Arguments is a JSON object encoded as a string
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"` // only set on streamed deltas
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
 
 type Usage struct {
@@ -37,24 +71,97 @@ type Usage struct {
 type Prompt struct {
 	Model    string    `json:"model"`
 	Messages []Message `json:"messages"`
+	Tools    []Tool    `json:"tools,omitempty"`
+	Stream   bool      `json:"stream,omitempty"`
+}
+
+// ChatCompletionChunk is one server-sent event of a streamed chat completion
+type ChatCompletionChunk struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int64         `json:"created"`
+	Model   string        `json:"model"`
+	Choices []ChunkChoice `json:"choices"`
+}
+
+type ChunkChoice struct {
+	Index        int     `json:"index"`
+	Delta        Message `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
 }
 
 type XGroq struct {
 	ID string `json:"id"`
 }
 
+// DefaultSystemPrompt is used by agents that do not set their own
+const DefaultSystemPrompt = `You are Ivora, AI based speaking agent, you should talk like real human so assume everything needed to talk like a human and also your response size as you are speaking on a call, you should response in limited words. all of your responses should be in same language and it should sound well, if language of response is hindi then use '.' fullstop to break sentences . answeres should not exceed 500 character, and answers should me more than 200 chars. If the user wants to disconnect, say goodbye and use the hang_up tool`
+
+// InitPrompt starts a conversation with the default system prompt, the model is left
+// to the LLM backend unless the agent sets one
 func InitPrompt() *Prompt {
+	return NewPrompt(DefaultSystemPrompt, "")
+}
+
+// NewPrompt starts a conversation with the given system prompt
+func NewPrompt(systemPrompt, model string) *Prompt {
 	return &Prompt{
-		Model: "llama-3.3-70b-versatile",
-		Messages: []Message{
-			{
-				Role:    "system",
-				Content: `You are Ivora, AI based speaking agent, you should talk like real human so assume everything needed to talk like a human and also your response size as you are speaking on a call, you should response in limited words. all of your responses should be in same language and it should sound well, if language of response is hindi then use '.' fullstop to break sentences . answeres should not exceed 500 character, and answers should me more than 200 chars. If the user wants to disconnect, respond with 'close()'`,
-			},
-		},
+		Model:    model,
+		Messages: []Message{{Role: "system", Content: systemPrompt}},
 	}
 }
 
-func (p *Prompt) PushMessage(role, message string) {
+// PushMessage appends a message and returns its index in the conversation
+func (p *Prompt) PushMessage(role, message string) int {
 	p.Messages = append(p.Messages, Message{Role: role, Content: message})
+	return len(p.Messages) - 1
+}
+
+// Clone copies the prompt so it can be sent while the conversation keeps changing
+func (p *Prompt) Clone() *Prompt {
+	return &Prompt{
+		Model:    p.Model,
+		Messages: append([]Message(nil), p.Messages...),
+		Tools:    p.Tools,
+		Stream:   p.Stream,
+	}
+}
+
+// PushToolResult appends the result of the tool call with the given id
+func (p *Prompt) PushToolResult(call ToolCall, result string) int {
+	p.Messages = append(p.Messages, Message{Role: "tool", ToolCallID: call.ID, Name: call.Function.Name, Content: result})
+	return len(p.Messages) - 1
+}
+
+// SetToolCalls records the tool calls the assistant made in the message at index
+func (p *Prompt) SetToolCalls(index int, calls []ToolCall) {
+	if index < 0 || index >= len(p.Messages) {
+		return
+	}
+	p.Messages[index].ToolCalls = calls
+}
+
+// SetContent replaces the content of the message at index unless the caller interrupted it
+func (p *Prompt) SetContent(index int, content string) {
+	if index < 0 || index >= len(p.Messages) || p.Messages[index].Interrupted {
+		return
+	}
+	p.Messages[index].Content = content
+}
+
+// InterruptedMarker is appended to assistant turns the caller talked over
+const InterruptedMarker = " [interrupted by caller]"
+
+// MarkInterrupted rewrites the assistant message at index to the part the caller actually heard
+// before talking over the agent, so the LLM does not assume it said the rest
+func (p *Prompt) MarkInterrupted(index int, heard string) {
+	if index < 0 || index >= len(p.Messages) {
+		return
+	}
+	m := &p.Messages[index]
+	if m.Role != "assistant" || m.Interrupted {
+		return
+	}
+	m.Interrupted = true
+	m.Content = strings.TrimSpace(strings.TrimSpace(heard) + InterruptedMarker)
 }
@@ -0,0 +1,26 @@
+package domain
+
+import "testing"
+
+func TestMarkInterruptedKeepsHeardPortion(t *testing.T) {
+	p := InitPrompt()
+	p.PushMessage("user", "What are your hours?")
+	index := p.PushMessage("assistant", "We open at nine. We close at six. Weekends are by appointment.")
+
+	p.MarkInterrupted(index, "We open at nine.")
+	if got := p.Messages[index].Content; got != "We open at nine."+InterruptedMarker {
+		t.Fatalf("unexpected content %q", got)
+	}
+
+	// a second interruption of the same turn must not rewrite it again
+	p.MarkInterrupted(index, "")
+	if got := p.Messages[index].Content; got != "We open at nine."+InterruptedMarker {
+		t.Fatalf("turn rewritten twice: %q", got)
+	}
+
+	// only assistant turns are rewritten
+	p.MarkInterrupted(index-1, "")
+	if p.Messages[index-1].Content != "What are your hours?" {
+		t.Fatal("user message was rewritten")
+	}
+}
@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// TranscriptEventType says what a speech to text provider observed
+type TranscriptEventType string
+
+const (
+	// TranscriptPartial is an interim guess that may still change
+	TranscriptPartial TranscriptEventType = "partial"
+	// TranscriptFinal is text that will not change anymore, one utterance may have several
+	TranscriptFinal TranscriptEventType = "final"
+	// SpeechStarted is sent when the provider hears the caller start talking, before any text
+	SpeechStarted TranscriptEventType = "speech_started"
+	// UtteranceEnd is sent when the caller stopped talking, the finals since the last one form the utterance
+	UtteranceEnd TranscriptEventType = "utterance_end"
+	// TranscriptFailed is sent when the provider lost its connection for good, no events follow
+	TranscriptFailed TranscriptEventType = "failed"
+)
+
+// TranscriptEvent is one event of a streaming speech to text provider
+type TranscriptEvent struct {
+	Type       TranscriptEventType
+	Text       string        // empty for SpeechStarted and UtteranceEnd
+	Confidence float64       // 0 to 1, 0 when the provider does not report it
+	Start      time.Duration // offset of the audio from the start of the stream
+	End        time.Duration
+	ReceivedAt time.Time
+}
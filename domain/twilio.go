@@ -1,11 +1,187 @@
 package domain
 
-// MediaStream represents WebSocket messages
-type MediaStream struct {
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Twilio Media Streams event names
+const (
+	EventConnected = "connected"
+	EventStart     = "start"
+	EventMedia     = "media"
+	EventMark      = "mark"
+	EventDTMF      = "dtmf"
+	EventStop      = "stop"
+	EventClear     = "clear"
+)
+
+// StreamMessage is any message exchanged on the Media Streams WebSocket
+type StreamMessage interface {
+	EventName() string
+}
+
+// ConnectedMessage is the first message Twilio sends after the socket opens
+type ConnectedMessage struct {
+	Event    string `json:"event"`
+	Protocol string `json:"protocol"`
+	Version  string `json:"version"`
+}
+
+// StartMessage carries the call metadata, it is sent once before any media
+type StartMessage struct {
+	Event          string        `json:"event"`
+	SequenceNumber int           `json:"sequenceNumber,string"`
+	StreamSid      string        `json:"streamSid"`
+	Start          StartMetadata `json:"start"`
+}
+
+type StartMetadata struct {
+	StreamSid        string            `json:"streamSid"`
+	AccountSid       string            `json:"accountSid"`
+	CallSid          string            `json:"callSid"`
+	Tracks           []string          `json:"tracks"`
+	CustomParameters map[string]string `json:"customParameters"`
+	MediaFormat      MediaFormat       `json:"mediaFormat"`
+}
+
+type MediaFormat struct {
+	Encoding   string `json:"encoding"`
+	SampleRate int    `json:"sampleRate"`
+	Channels   int    `json:"channels"`
+}
+
+// MediaMessage carries base64 audio, inbound from the caller or outbound to be played
+type MediaMessage struct {
+	Event          string       `json:"event"`
+	SequenceNumber int          `json:"sequenceNumber,omitempty,string"`
+	StreamSid      string       `json:"streamSid"`
+	Media          MediaPayload `json:"media"`
+}
+
+type MediaPayload struct {
+	Track     string `json:"track,omitempty"`
+	Chunk     int    `json:"chunk,omitempty,string"`
+	Timestamp int64  `json:"timestamp,omitempty,string"` // ms since the stream started
+	Payload   string `json:"payload"`
+}
+
+// MarkMessage is sent after outbound media, Twilio echoes it back once that audio has played
+type MarkMessage struct {
+	Event          string `json:"event"`
+	SequenceNumber int    `json:"sequenceNumber,omitempty,string"`
+	StreamSid      string `json:"streamSid"`
+	Mark           Mark   `json:"mark"`
+}
+
+type Mark struct {
+	Name string `json:"name"`
+}
+
+// DTMFMessage is a keypress from the caller
+type DTMFMessage struct {
+	Event          string `json:"event"`
+	SequenceNumber int    `json:"sequenceNumber,string"`
+	StreamSid      string `json:"streamSid"`
+	DTMF           DTMF   `json:"dtmf"`
+}
+
+type DTMF struct {
+	Track string `json:"track"`
+	Digit string `json:"digit"`
+}
+
+// StopMessage is sent when the stream ends or the call hangs up
+type StopMessage struct {
+	Event          string       `json:"event"`
+	SequenceNumber int          `json:"sequenceNumber,string"`
+	StreamSid      string       `json:"streamSid"`
+	Stop           StopMetadata `json:"stop"`
+}
+
+type StopMetadata struct {
+	AccountSid string `json:"accountSid"`
+	CallSid    string `json:"callSid"`
+}
+
+// ClearMessage asks Twilio to drop all audio buffered for playback
+type ClearMessage struct {
 	Event     string `json:"event"`
 	StreamSid string `json:"streamSid"`
-	Media     struct {
-		Track   string `json:"track"`
-		Payload string `json:"payload"`
-	} `json:"media"`
+}
+
+func (ConnectedMessage) EventName() string { return EventConnected }
+func (StartMessage) EventName() string     { return EventStart }
+func (MediaMessage) EventName() string     { return EventMedia }
+func (MarkMessage) EventName() string      { return EventMark }
+func (DTMFMessage) EventName() string      { return EventDTMF }
+func (StopMessage) EventName() string      { return EventStop }
+func (ClearMessage) EventName() string     { return EventClear }
+
+// NewMediaMessage builds an outbound media message for raw μ-law audio
+func NewMediaMessage(streamSid string, audio []byte) MediaMessage {
+	return MediaMessage{
+		Event:     EventMedia,
+		StreamSid: streamSid,
+		Media:     MediaPayload{Payload: base64.StdEncoding.EncodeToString(audio)},
+	}
+}
+
+// NewMarkMessage builds an outbound mark message
+func NewMarkMessage(streamSid, name string) MarkMessage {
+	return MarkMessage{Event: EventMark, StreamSid: streamSid, Mark: Mark{Name: name}}
+}
+
+// NewClearMessage builds an outbound clear message
+func NewClearMessage(streamSid string) ClearMessage {
+	return ClearMessage{Event: EventClear, StreamSid: streamSid}
+}
+
+// Audio decodes the base64 payload
+func (m MediaMessage) Audio() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(m.Media.Payload)
+}
+
+// Param returns a <Parameter> value sent in the TwiML <Stream>
+func (m StartMessage) Param(name string) string {
+	return m.Start.CustomParameters[name]
+}
+
+// DecodeMediaStream parses a message received from Twilio into its typed form
+func DecodeMediaStream(data []byte) (StreamMessage, error) {
+	var envelope struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	var msg StreamMessage
+	switch envelope.Event {
+	case EventConnected:
+		msg = &ConnectedMessage{}
+	case EventStart:
+		msg = &StartMessage{}
+	case EventMedia:
+		msg = &MediaMessage{}
+	case EventMark:
+		msg = &MarkMessage{}
+	case EventDTMF:
+		msg = &DTMFMessage{}
+	case EventStop:
+		msg = &StopMessage{}
+	default:
+		return nil, fmt.Errorf("unknown media stream event %q", envelope.Event)
+	}
+
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("decoding %s event: %w", envelope.Event, err)
+	}
+	return msg, nil
+}
+
+// EncodeMediaStream serializes a message to be sent to Twilio
+func EncodeMediaStream(msg StreamMessage) ([]byte, error) {
+	return json.Marshal(msg)
 }
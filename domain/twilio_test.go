@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeMediaStream(t *testing.T) {
+	start := `{"event":"start","sequenceNumber":"1","start":{"accountSid":"AC1","streamSid":"MZ1","callSid":"CA1","tracks":["inbound"],"mediaFormat":{"encoding":"audio/x-mulaw","sampleRate":8000,"channels":1},"customParameters":{"agent_id":"FNWYO5RqakGnPMcYXmua"}},"streamSid":"MZ1"}`
+	msg, err := DecodeMediaStream([]byte(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := msg.(*StartMessage)
+	if !ok {
+		t.Fatalf("expected *StartMessage, got %T", msg)
+	}
+	if s.Start.CallSid != "CA1" || s.Param("agent_id") != "FNWYO5RqakGnPMcYXmua" || s.Start.MediaFormat.SampleRate != 8000 || s.SequenceNumber != 1 {
+		t.Fatalf("start not decoded: %+v", s)
+	}
+
+	media := `{"event":"media","sequenceNumber":"3","media":{"track":"inbound","chunk":"1","timestamp":"5","payload":"/w=="},"streamSid":"MZ1"}`
+	msg, err = DecodeMediaStream([]byte(media))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := msg.(*MediaMessage)
+	audio, err := m.Audio()
+	if err != nil || len(audio) != 1 || audio[0] != 0xff || m.Media.Chunk != 1 || m.Media.Timestamp != 5 {
+		t.Fatalf("media not decoded: %+v %v", m, err)
+	}
+
+	dtmf := `{"event":"dtmf","streamSid":"MZ1","sequenceNumber":"5","dtmf":{"track":"inbound_track","digit":"1"}}`
+	msg, err = DecodeMediaStream([]byte(dtmf))
+	if err != nil || msg.(*DTMFMessage).DTMF.Digit != "1" {
+		t.Fatalf("dtmf not decoded: %+v %v", msg, err)
+	}
+
+	if _, err := DecodeMediaStream([]byte(`{"event":"unknown"}`)); err == nil {
+		t.Fatal("unknown event accepted")
+	}
+}
+
+func TestEncodeMediaStream(t *testing.T) {
+	data, err := EncodeMediaStream(NewMediaMessage("MZ1", []byte{0xff}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(data, &got)
+	if got["event"] != "media" || got["streamSid"] != "MZ1" || got["media"].(map[string]interface{})["payload"] != "/w==" {
+		t.Fatalf("unexpected media message %s", data)
+	}
+	if _, ok := got["sequenceNumber"]; ok {
+		t.Fatalf("outbound media should not carry a sequence number: %s", data)
+	}
+
+	data, _ = EncodeMediaStream(NewMarkMessage("MZ1", "utterance-1"))
+	if string(data) != `{"event":"mark","streamSid":"MZ1","mark":{"name":"utterance-1"}}` {
+		t.Fatalf("unexpected mark message %s", data)
+	}
+	data, _ = EncodeMediaStream(NewClearMessage("MZ1"))
+	if string(data) != `{"event":"clear","streamSid":"MZ1"}` {
+		t.Fatalf("unexpected clear message %s", data)
+	}
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"twilio-go-stream/sdk/twilio"
+)
+
+// requireTwilioSignature only lets requests signed by Twilio through to next.
+// scheme is the scheme Twilio used to reach us ("https" for webhooks, "wss" for media streams).
+func (c *Client) requireTwilioSignature(scheme string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.skipSignature {
+			next(w, r)
+			return
+		}
+
+		if c.twilio == nil {
+			log.Printf("Rejecting %s: Twilio auth token not configured", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			log.Printf("Rejecting %s: cannot parse form: %v", r.URL.Path, err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		// Twilio signs the public URL it called, not the one we see behind the load balancer
+		url := scheme + "://" + c.PublicURL + r.URL.RequestURI()
+		if !c.twilio.ValidateSignature(url, r.PostForm, r.Header.Get(twilio.SignatureHeader)) {
+			log.Printf("Rejecting %s: invalid Twilio signature from %s", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"twilio-go-stream/sdk/twilio"
+)
+
+func TestRequireTwilioSignature(t *testing.T) {
+	c := Must("voice.example.com", &twilio.Client{Secret: "token"}, nil)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	h := c.requireTwilioSignature("https", ok)
+
+	form := url.Values{"CallSid": {"CA123"}, "From": {"+15550001111"}}
+	newRequest := func(signature string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/incoming-call", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if signature != "" {
+			r.Header.Set(twilio.SignatureHeader, signature)
+		}
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	h(w, newRequest(twilio.ComputeSignature("token", "https://voice.example.com/incoming-call", form)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("signed request got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h(w, newRequest(""))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("unsigned request got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h(w, newRequest(twilio.ComputeSignature("wrong", "https://voice.example.com/incoming-call", form)))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("request signed with wrong token got %d", w.Code)
+	}
+}
+
+func TestRequireTwilioSignatureWebSocket(t *testing.T) {
+	c := Must("voice.example.com", &twilio.Client{Secret: "token"}, nil)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	h := c.requireTwilioSignature("wss", ok)
+
+	r := httptest.NewRequest(http.MethodGet, "/media-stream", nil)
+	r.Header.Set(twilio.SignatureHeader, twilio.ComputeSignature("token", "wss://voice.example.com/media-stream", nil))
+	w := httptest.NewRecorder()
+	h(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("signed upgrade got %d", w.Code)
+	}
+}
+
+func TestIncomingCallRejectsMalformedForm(t *testing.T) {
+	c := Must("voice.example.com", &twilio.Client{}, nil)
+	r := httptest.NewRequest(http.MethodPost, "/incoming-call", strings.NewReader("To=%zz"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	c.handleIncomingCall(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("malformed form got %d", w.Code)
+	}
+}
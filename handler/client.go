@@ -5,163 +5,306 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"twilio-go-stream/domain"
+	"twilio-go-stream/internal/agent"
+	"twilio-go-stream/internal/config"
 	"twilio-go-stream/internal/core"
-	"twilio-go-stream/sdk/deepgram"
-	"twilio-go-stream/sdk/gcp"
+	"twilio-go-stream/internal/provider"
+	"twilio-go-stream/internal/session"
+	"twilio-go-stream/internal/tools"
+	"twilio-go-stream/sdk/twilio"
 
 	"github.com/gorilla/websocket"
 )
 
-type Corer interface {
-	Talk(*websocket.Conn)
-}
+// startTimeout is how long we wait for Twilio's "start" event after the upgrade
+const startTimeout = 10 * time.Second
+
 type Client struct {
-	core        Corer
-	PublicURL   string
-	sttProvider string
-	ttsProvider string
+	sessions      *session.Manager
+	PublicURL     string
+	cfg           *config.Config
+	twilio        *twilio.Client
+	llm           core.LanguageProcessor
+	skipSignature bool
+	tools         *tools.Registry // shared tools, every call gets its own copy
+	transfer      core.TransferConfig
+	farewell      string
+	summaries     sync.Map // parent call sid -> summary whispered to the human on transfer
+	agents        *agent.Store
 }
 
-var wsConn *websocket.Conn
-
-// WebSocket upgrader
+// WebSocket upgrader, requests reach it only after the Twilio signature is verified
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-// New creates a new Client with the specified providers
-func New(publicUrl string, sttProvider string, ttsProvider string) *Client {
-	return &Client{
-		PublicURL:   publicUrl,
-		sttProvider: sttProvider,
-		ttsProvider: ttsProvider,
+// New creates a new Client with the providers and call settings of cfg.
+// twilioClient holds the auth token used to verify that requests come from Twilio.
+func New(cfg *config.Config, twilioClient *twilio.Client, llm core.LanguageProcessor) *Client {
+	c := &Client{
+		PublicURL: cfg.Server.PublicURL,
+		cfg:       cfg,
+		twilio:    twilioClient,
+		llm:       llm,
+		sessions:  session.NewManager(),
+		transfer:  transferConfig(cfg.Transfer),
+		farewell:  cfg.Call.Farewell,
 	}
+	if !cfg.Twilio.ValidateSignature {
+		c.SkipSignatureValidation()
+	}
+	return c
 }
 
 // Must creates a client with default settings (deprecated, use New instead)
-func Must(publicUrl string) *Client {
-	return New(publicUrl, "deepgram", "deepgram")
+func Must(publicUrl string, twilioClient *twilio.Client, llm core.LanguageProcessor) *Client {
+	cfg := config.Default()
+	cfg.Server.PublicURL = publicUrl
+	return New(cfg, twilioClient, llm)
+}
+
+// SkipSignatureValidation disables X-Twilio-Signature checks, only meant for local development
+func (c *Client) SkipSignatureValidation() {
+	log.Println("WARNING: Twilio signature validation is disabled")
+	c.skipSignature = true
+}
+
+// UseTools offers the registry's tools to the LLM on every call, on top of hang_up and transfer_call
+func (c *Client) UseTools(registry *tools.Registry) {
+	c.tools = registry
+}
+
+// UseAgents answers calls with the agent profiles of store, without it every call gets agent.Default
+func (c *Client) UseAgents(store *agent.Store) {
+	c.agents = store
+}
+
+// SetFarewell sets what the agent says before hanging up on the caller
+func (c *Client) SetFarewell(farewell string) {
+	c.farewell = farewell
+}
+
+// TransferTo sets where callers are transferred when they ask for a person
+func (c *Client) TransferTo(cfg core.TransferConfig) {
+	c.transfer = cfg
 }
 
 func (c *Client) SetRoutes() {
-	http.HandleFunc("/incoming-call", c.handleIncomingCall)
-	http.HandleFunc("/media-stream", c.handleMediaStream)
+	http.HandleFunc("/incoming-call", c.requireTwilioSignature("https", c.handleIncomingCall))
+	http.HandleFunc("/media-stream", c.requireTwilioSignature("wss", c.handleMediaStream))
+	http.HandleFunc("/transfer-whisper", c.requireTwilioSignature("https", c.handleTransferWhisper))
 
 }
 
-// Handles incoming calls and returns TwiML response
+// Handles incoming calls and returns TwiML response, the agent is chosen by the agent_id query
+// parameter of the webhook URL or by the number that was called
 func (c *Client) handleIncomingCall(w http.ResponseWriter, r *http.Request) {
 	log.Println("Incoming call received!")
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Rejecting incoming call: cannot parse form: %v", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	called := r.PostForm.Get("To")
+	profile := c.agents.Select(r.URL.Query().Get("agent_id"), called)
+	log.Printf("Call to %s routed to agent %s", called, profile.ID)
+
 	Host := c.PublicURL
-	// fmt.Println("Host:", Host)
 	twiml := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <Response>
     <Connect>
         <Stream track="inbound_track" url="wss://%s/media-stream">
-            <Parameter name="agent_id" value="FNWYO5RqakGnPMcYXmua" />
+            <Parameter name="agent_id" value="%s" />
+            <Parameter name="to" value="%s" />
         </Stream>
     </Connect>
-</Response>`, Host)
+</Response>`, Host, escapeXML(profile.ID), escapeXML(called))
 
 	w.Header().Set("Content-Type", "application/xml")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(twiml))
 }
 
-// WebSocket handler for Twilio's MediaStream
+// WebSocket handler for Twilio's MediaStream, every stream gets its own session
 func (c *Client) handleMediaStream(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	// Upgrade to WebSocket
+	wsConn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Error upgrading to WebSocket:", err)
+		return
+	}
+	defer wsConn.Close()
+	log.Println("New WebSocket connection established.")
 
-	// Variables for providers
-	var gcpSTT *gcp.GoogleSTTClient
-	var gcpTTS *gcp.GoogleTTSClient
-	var deepgramTTS *deepgram.MyCallback
-	var deepgramSTT *deepgram.DeepgramSTTCallback
-
-	// Initialize STT based on provider setting
-	switch c.sttProvider {
-	case "gcp":
-		log.Println("Setting up Google STT")
-		var err error
-		gcpSTT, err = gcp.NewGoogleSTTClient()
-		if err != nil {
-			log.Printf("Error initializing Google STT: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
+	// Providers are per call, so wait until Twilio tells us which call this is
+	start, err := waitForStart(wsConn)
+	if err != nil {
+		log.Println("Media stream did not start:", err)
+		return
+	}
 
-		// Start Google STT stream - only initialize, don't start Transcribe yet
-		gcpSTT.StartStreamingAndAttach()
-		// We'll start Transcribe after setting up the AgentResponse callback
-		go gcpSTT.SendAudioInRealTime()
-
-		defer gcpSTT.Close()
-	case "deepgram":
-		log.Println("Setting up Deepgram STT")
-		deepgramSTT = deepgram.InitSTT()
-		if deepgramSTT == nil {
-			log.Println("Error initializing Deepgram STT")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		deepgramSTT.ConnectWS()
-		defer deepgramSTT.Disconnect()
-	default:
-		log.Printf("Unknown STT provider: %s", c.sttProvider)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	sess, err := c.newSession(start)
+	if err != nil {
+		log.Printf("Error creating session for stream %s: %v", start.StreamSid, err)
 		return
 	}
+	if err := c.sessions.Add(sess); err != nil {
+		log.Println("Error registering session:", err)
+		sess.Close()
+		return
+	}
+	defer c.sessions.Remove(sess.StreamSid)
+
+	//pass ws to core
+	sess.Core.Talk(wsConn, start)
+}
+
+// waitForStart reads the stream until Twilio sends the "start" event
+func waitForStart(wsConn *websocket.Conn) (*domain.StartMessage, error) {
+	wsConn.SetReadDeadline(time.Now().Add(startTimeout))
+	defer wsConn.SetReadDeadline(time.Time{})
 
-	// Initialize TTS based on provider setting
-	switch c.ttsProvider {
-	case "gcp":
-		log.Println("Setting up Google TTS")
-		var err error
-		gcpTTS, err = gcp.NewGoogleTTSClient(ctx)
+	for {
+		_, message, err := wsConn.ReadMessage()
 		if err != nil {
-			log.Printf("Error initializing Google TTS: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+			return nil, err
 		}
-		defer gcpTTS.Close()
-	case "deepgram":
-		log.Println("Setting up Deepgram TTS")
-		deepgramTTS = deepgram.Init()
-		if deepgramTTS == nil {
-			log.Println("Error initializing Deepgram TTS")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+		msg, err := domain.DecodeMediaStream(message)
+		if err != nil {
+			log.Println("Error decoding media stream message:", err)
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *domain.StartMessage:
+			log.Printf("Stream SID received: %s (call %s, format %+v)\n", msg.StreamSid, msg.Start.CallSid, msg.Start.MediaFormat)
+			return msg, nil
+		case *domain.ConnectedMessage:
+			log.Printf("Media stream connected, protocol %s %s", msg.Protocol, msg.Version)
+		case *domain.StopMessage:
+			return nil, fmt.Errorf("stream stopped before start")
+		default:
+			log.Printf("Ignoring %q event before stream start", msg.EventName())
 		}
-		deepgramTTS.ConnectTTS()
-		defer deepgramTTS.Disconnect()
-	default:
-		log.Printf("Unknown TTS provider: %s", c.ttsProvider)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
 	}
+}
+
+// restartingSTT is a speech to text provider that replaces its stream during a call,
+// Google's streams are time limited
+type restartingSTT interface {
+	Restarts() int
+}
+
+// newSession builds the providers and core client for one call,
+// everything that is created is torn down by the session on Close
+func (c *Client) newSession(start *domain.StartMessage) (*session.Session, error) {
+	ctx := context.Background()
+	sess := session.New(start.StreamSid, start.Start.CallSid)
+
+	// the agent was picked by /incoming-call, the called number covers streams started elsewhere
+	profile := c.agents.Select(start.Param("agent_id"), start.Param("to"))
+	sess.AgentID = profile.ID
+	log.Printf("Call %s is answered by agent %s", start.Start.CallSid, profile.ID)
+
+	fail := func(err error) (*session.Session, error) {
+		sess.Close()
+		return nil, err
+	}
+
+	// providers are built by name, the agent may pick its own language, model and voice
+	stt, err := provider.NewSTT(ctx, c.cfg.STT.Provider, c.cfg, profile)
+	if err != nil {
+		return fail(fmt.Errorf("initializing STT: %w", err))
+	}
+	if err := stt.Start(ctx); err != nil {
+		return fail(fmt.Errorf("starting STT: %w", err))
+	}
+	sess.OnClose(stt.Stop)
+	if restarting, ok := stt.(restartingSTT); ok {
+		sess.OnClose(func() {
+			log.Printf("STT of stream %s replaced its stream %d times", start.StreamSid, restarting.Restarts())
+		})
+	}
+
+	tts, err := provider.NewTTS(ctx, c.cfg.TTS.Provider, c.cfg, profile)
+	if err != nil {
+		return fail(fmt.Errorf("initializing TTS: %w", err))
+	}
+	sess.OnClose(tts.Stop)
 
 	// Create core client with the initialized providers
-	coreClient := core.Must(gcpSTT, gcpTTS, deepgramTTS, deepgramSTT)
-	c.core = coreClient
+	coreClient := core.Must(stt, tts, c.llm)
+	coreClient.SetSystemPrompt(profile.SystemPrompt, profile.LLM.Model)
+	coreClient.Greeting = profile.Greeting
+	coreClient.Transfer = c.transferCall
+	coreClient.TransferConfig = profile.TransferConfig(c.transfer)
+	coreClient.EndCall = c.endCall
+	if c.farewell != "" {
+		coreClient.Farewell = c.farewell
+	}
+	if profile.Farewell != "" {
+		coreClient.Farewell = profile.Farewell
+	}
+	coreClient.Interrupt.MaxCallDuration = orDefault(profile.Timeouts.MaxCallDuration, c.cfg.Call.MaxDuration)
+	coreClient.Interrupt.SilenceTimeout = orDefault(profile.Timeouts.Silence, c.cfg.Call.SilenceTimeout)
+	coreClient.Interrupt.InterruptCooldown = c.cfg.Call.InterruptCooldown.Duration
+	coreClient.Interrupt.RepromptCooldown = c.cfg.Call.RepromptCooldown.Duration
+	coreClient.SetAudioLead(c.cfg.Call.AudioLead.Duration)
+	coreClient.SetDTMFTimeout(orDefault(profile.Timeouts.DTMF, c.cfg.Call.DTMFTimeout))
+
+	registry, err := profile.Registry(c.tools)
+	if err != nil {
+		return fail(fmt.Errorf("building tools of agent %s: %w", profile.ID, err))
+	}
+	if err := coreClient.UseTools(registry); err != nil {
+		return fail(fmt.Errorf("registering tools: %w", err))
+	}
+	if dir := c.cfg.Call.RecordDir; dir != "" {
+		recording, err := os.Create(filepath.Join(dir, start.Start.CallSid+".agent.ulaw"))
+		if err != nil {
+			return fail(fmt.Errorf("recording agent audio: %w", err))
+		}
+		coreClient.RecordAgentAudio(recording)
+		sess.OnClose(func() { recording.Close() })
+	}
 	stopChan := make(chan struct{})
 	coreClient.Interrupt.Manager(stopChan)
-	defer close(stopChan)
+	sess.OnClose(func() { close(stopChan) })
+	// registered last so it runs first, the turn stops before its providers do
+	sess.OnClose(coreClient.Close)
+	sess.Core = coreClient
 
-	// Now that we have the core client with AgentResponse, start Google STT transcription if needed
-	if gcpSTT != nil {
-		gcpSTT.Transcribe()
-	}
+	return sess, nil
+}
 
-	log.Println("New WebSocket connection established.")
+// transferConfig turns the server's transfer settings into the ones of a call
+func transferConfig(cfg config.Transfer) core.TransferConfig {
+	keywords := cfg.Keywords
+	if keywords == nil {
+		keywords = core.DefaultTransferKeywords
+	}
+	return core.TransferConfig{
+		Target:      cfg.Target,
+		HoldMessage: cfg.HoldMessage,
+		Keywords:    keywords,
+		Whisper:     cfg.Whisper,
+		Webhook:     cfg.Webhook,
+	}
+}
 
-	// Upgrade to WebSocket
-	wsConn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println("Error upgrading to WebSocket:", err)
-		return
+func orDefault(agentValue, server config.Duration) time.Duration {
+	if agentValue.Duration > 0 {
+		return agentValue.Duration
 	}
+	return server.Duration
+}
 
-	//pass ws to core
-	c.core.Talk(wsConn)
-	defer wsConn.Close()
+// Sessions exposes the live call registry
+func (c *Client) Sessions() *session.Manager {
+	return c.sessions
 }
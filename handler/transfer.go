@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"twilio-go-stream/internal/core"
+)
+
+var webhookClient = &http.Client{Timeout: 5 * time.Second}
+
+// summaryTTL is how long a transfer summary waits for the human to pick up
+const summaryTTL = 10 * time.Minute
+
+// transferCall briefs the human and redirects the live call to a <Dial> of cfg.Target
+func (c *Client) transferCall(ctx context.Context, callSid string, cfg core.TransferConfig, summary string) error {
+	if c.twilio == nil {
+		return fmt.Errorf("twilio client not configured")
+	}
+
+	if cfg.Webhook != "" {
+		if err := postTransferWebhook(ctx, cfg.Webhook, callSid, cfg.Target, summary); err != nil {
+			// the caller still gets their human, the briefing is best effort
+			log.Printf("Transfer webhook for call %s failed: %v", callSid, err)
+		}
+	}
+
+	whisperURL := ""
+	if cfg.Whisper && summary != "" {
+		c.summaries.Store(callSid, summary)
+		// the human may never answer
+		time.AfterFunc(summaryTTL, func() { c.summaries.Delete(callSid) })
+		whisperURL = "https://" + c.PublicURL + "/transfer-whisper?" + url.Values{"call": {callSid}}.Encode()
+	}
+	return c.twilio.UpdateCall(ctx, callSid, dialTwiML(cfg.Target, whisperURL))
+}
+
+// endCall completes the call at Twilio
+func (c *Client) endCall(ctx context.Context, callSid string) error {
+	if c.twilio == nil {
+		return fmt.Errorf("twilio client not configured")
+	}
+	return c.twilio.EndCall(ctx, callSid)
+}
+
+// dialTwiML connects the caller to target, a phone number or a sip: URI. With whisperURL
+// Twilio fetches TwiML from it and plays it to the human before bridging the caller.
+func dialTwiML(target, whisperURL string) string {
+	noun := "Number"
+	if strings.HasPrefix(target, "sip:") || strings.HasPrefix(target, "sips:") {
+		noun = "Sip"
+	}
+	attrs := ""
+	if whisperURL != "" {
+		attrs = ` url="` + escapeXML(whisperURL) + `"`
+	}
+	return "<Response><Dial><" + noun + attrs + ">" + escapeXML(target) + "</" + noun + "></Dial></Response>"
+}
+
+// handleTransferWhisper reads the call summary to the human answering a transfer
+func (c *Client) handleTransferWhisper(w http.ResponseWriter, r *http.Request) {
+	callSid := r.URL.Query().Get("call")
+	summary, ok := c.summaries.LoadAndDelete(callSid)
+	twiml := "<Response></Response>"
+	if ok {
+		twiml = "<Response><Say>" + escapeXML(summary.(string)) + "</Say></Response>"
+	} else {
+		log.Printf("No transfer summary for call %s", callSid)
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(twiml))
+}
+
+// postTransferWebhook sends the briefing to an external system, e.g. the human agent's CRM
+func postTransferWebhook(ctx context.Context, webhook, callSid, target, summary string) error {
+	body, err := json.Marshal(map[string]string{"call_sid": callSid, "target": target, "summary": summary})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+	return nil
+}
+
+func escapeXML(s string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"twilio-go-stream/internal/config"
+	"twilio-go-stream/internal/core"
+	"twilio-go-stream/sdk/twilio"
+)
+
+func TestDialTwiML(t *testing.T) {
+	if got := dialTwiML("+15550001", ""); got != "<Response><Dial><Number>+15550001</Number></Dial></Response>" {
+		t.Fatalf("unexpected TwiML %s", got)
+	}
+	got := dialTwiML("sip:agent@example.com", "https://voice.example.com/transfer-whisper?call=CA1&x=1")
+	if got != `<Response><Dial><Sip url="https://voice.example.com/transfer-whisper?call=CA1&amp;x=1">sip:agent@example.com</Sip></Dial></Response>` {
+		t.Fatalf("unexpected TwiML %s", got)
+	}
+}
+
+func TestTransferCall(t *testing.T) {
+	var twiml string
+	var briefing map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2010-04-01/Accounts/AC1/Calls/CA1.json":
+			twiml = r.FormValue("Twiml")
+			w.Write([]byte(`{"sid":"CA1"}`))
+		case "/crm":
+			json.NewDecoder(r.Body).Decode(&briefing)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := Must("voice.example.com", twilio.New(server.URL, "AC1", "token"), nil)
+	cfg := core.TransferConfig{Target: "+15550001", Whisper: true, Webhook: server.URL + "/crm"}
+	if err := c.transferCall(context.Background(), "CA1", cfg, "Order 42 is lost & the caller wants a refund."); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(twiml, `<Number url="https://voice.example.com/transfer-whisper?call=CA1">+15550001</Number>`) {
+		t.Fatalf("call not redirected to the target: %s", twiml)
+	}
+	if briefing["call_sid"] != "CA1" || briefing["summary"] == "" {
+		t.Fatalf("webhook not briefed: %v", briefing)
+	}
+
+	// Twilio fetches the whisper once the human answers
+	w := httptest.NewRecorder()
+	c.handleTransferWhisper(w, httptest.NewRequest(http.MethodPost, "/transfer-whisper?call=CA1", nil))
+	if body := w.Body.String(); body != "<Response><Say>Order 42 is lost &amp; the caller wants a refund.</Say></Response>" {
+		t.Fatalf("unexpected whisper %s", body)
+	}
+	w = httptest.NewRecorder()
+	c.handleTransferWhisper(w, httptest.NewRequest(http.MethodPost, "/transfer-whisper?call=CA1", nil))
+	if body := w.Body.String(); body != "<Response></Response>" {
+		t.Fatalf("summary whispered twice: %s", body)
+	}
+}
+
+func TestTransferConfigKeepsBuiltinKeywords(t *testing.T) {
+	if cfg := transferConfig(config.Transfer{Target: "+15550001"}); len(cfg.Keywords) != len(core.DefaultTransferKeywords) || cfg.Target != "+15550001" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if cfg := transferConfig(config.Transfer{Keywords: []string{}}); len(cfg.Keywords) != 0 {
+		t.Fatalf("an empty list should disable keywords, got %q", cfg.Keywords)
+	}
+}
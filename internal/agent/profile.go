@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"twilio-go-stream/domain"
+	"twilio-go-stream/internal/config"
+	"twilio-go-stream/internal/core"
+	"twilio-go-stream/internal/tools"
+	"twilio-go-stream/sdk/gcp"
+)
+
+// DefaultID is the profile used when a call matches no other profile
+const DefaultID = "default"
+
+// Profile is everything that makes one voice agent different from another
+type Profile struct {
+	ID           string                `json:"id"`
+	PhoneNumbers []string              `json:"phone_numbers"` // called numbers answered by this agent, E.164
+	SystemPrompt string                `json:"system_prompt"`
+	Greeting     string                `json:"greeting"`
+	Farewell     string                `json:"farewell"`
+	LLM          LLM                   `json:"llm"`
+	STT          STT                   `json:"stt"`
+	TTS          TTS                   `json:"tts"`
+	Timeouts     Timeouts              `json:"timeouts"`
+	Tools        []tools.WebhookConfig `json:"tools"`
+	Transfer     Transfer              `json:"transfer"`
+}
+
+type LLM struct {
+	Model string `json:"model"` // empty uses the backend's model
+}
+
+type STT struct {
+	Language string `json:"language"` // e.g. "en-IN" for Google, "hi" for Deepgram
+	Model    string `json:"model"`    // e.g. "phone_call" or "latest_short" for Google, "nova-2" for Deepgram
+	// Vocabulary are domain words such as product or city names, boosted by every provider
+	Vocabulary []string `json:"vocabulary"`
+
+	// Google only, left empty they use the server settings
+	AlternativeLanguages []string            `json:"alternative_languages"`
+	Enhanced             *bool               `json:"enhanced"`
+	SpeechContexts       []gcp.SpeechContext `json:"speech_contexts"`
+}
+
+type TTS struct {
+	Voice string `json:"voice"` // e.g. "aura-asteria-en" for Deepgram, "hi-IN-Chirp3-HD-Aoede" for Google
+
+	// Google only, left empty they use the server settings
+	Language       string   `json:"language"`
+	SpeakingRate   *float64 `json:"speaking_rate"`
+	Pitch          *float64 `json:"pitch"`
+	VolumeGainDb   *float64 `json:"volume_gain_db"`
+	EffectsProfile []string `json:"effects_profile"`
+	SSML           *bool    `json:"ssml"`
+}
+
+// Google applies the agent's voice settings on top of the server's
+func (t TTS) Google(defaults gcp.TTSConfig) gcp.TTSConfig {
+	cfg := defaults
+	if t.Voice != "" {
+		cfg.Voice = t.Voice
+	}
+	if t.Language != "" {
+		cfg.Language = t.Language
+	}
+	if t.SpeakingRate != nil {
+		cfg.SpeakingRate = *t.SpeakingRate
+	}
+	if t.Pitch != nil {
+		cfg.Pitch = *t.Pitch
+	}
+	if t.VolumeGainDb != nil {
+		cfg.VolumeGainDb = *t.VolumeGainDb
+	}
+	if len(t.EffectsProfile) > 0 {
+		cfg.EffectsProfile = t.EffectsProfile
+	}
+	if t.SSML != nil {
+		cfg.SSML = *t.SSML
+	}
+	return cfg
+}
+
+// Timeouts left at zero use the server settings
+type Timeouts struct {
+	MaxCallDuration config.Duration `json:"max_call_duration"`
+	Silence         config.Duration `json:"silence"` // reprompt the caller after this long without speech
+	DTMF            config.Duration `json:"dtmf"`    // end a keypad entry after this long without a keypress
+}
+
+// Transfer overrides the server's transfer settings for this agent
+type Transfer struct {
+	Target      string   `json:"target"`
+	HoldMessage string   `json:"hold_message"`
+	Keywords    []string `json:"keywords"`
+	Whisper     *bool    `json:"whisper"`
+	Webhook     string   `json:"webhook"`
+}
+
+// Default is the agent used when no profiles are configured
+func Default() *Profile {
+	return &Profile{
+		ID:           DefaultID,
+		SystemPrompt: domain.DefaultSystemPrompt,
+		Greeting:     core.DefaultGreeting,
+	}
+}
+
+// Validate checks the profile can be used for calls, defaults are filled in
+func (p *Profile) Validate() error {
+	if p.ID == "" {
+		return fmt.Errorf("profile has no id")
+	}
+	if p.SystemPrompt == "" {
+		p.SystemPrompt = domain.DefaultSystemPrompt
+	}
+	if p.Greeting == "" {
+		p.Greeting = core.DefaultGreeting
+	}
+	for _, sc := range p.STT.SpeechContexts {
+		if err := sc.Validate(); err != nil {
+			return fmt.Errorf("agent %s: stt: %w", p.ID, err)
+		}
+	}
+	if err := p.TTS.Google(gcp.DefaultTTSConfig()).Validate(); err != nil {
+		return fmt.Errorf("agent %s: tts: %w", p.ID, err)
+	}
+	if _, err := p.Registry(nil); err != nil {
+		return fmt.Errorf("agent %s: %w", p.ID, err)
+	}
+	return nil
+}
+
+// Registry returns the tools offered to the LLM: the shared ones plus the agent's own webhooks
+func (p *Profile) Registry(shared *tools.Registry) (*tools.Registry, error) {
+	registry := shared.Clone()
+	for _, cfg := range p.Tools {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("tool %s has no url", cfg.Name)
+		}
+		if slices.Contains(core.BuiltinTools, cfg.Name) {
+			return nil, fmt.Errorf("tool %s is reserved for a built-in tool", cfg.Name)
+		}
+		if err := registry.Register(tools.Webhook(cfg)); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// TransferConfig applies the agent's transfer settings on top of the server's
+func (p *Profile) TransferConfig(defaults core.TransferConfig) core.TransferConfig {
+	cfg := defaults
+	if p.Transfer.Target != "" {
+		cfg.Target = p.Transfer.Target
+	}
+	if p.Transfer.HoldMessage != "" {
+		cfg.HoldMessage = p.Transfer.HoldMessage
+	}
+	if len(p.Transfer.Keywords) > 0 {
+		cfg.Keywords = p.Transfer.Keywords
+	}
+	if p.Transfer.Whisper != nil {
+		cfg.Whisper = *p.Transfer.Whisper
+	}
+	if p.Transfer.Webhook != "" {
+		cfg.Webhook = p.Transfer.Webhook
+	}
+	return cfg
+}
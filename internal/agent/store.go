@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Store holds the agent profiles and picks the one answering a call
+type Store struct {
+	byID     map[string]*Profile
+	byNumber map[string]*Profile
+}
+
+// NewStore indexes profiles by id and phone number, both must be unique
+func NewStore(profiles ...*Profile) (*Store, error) {
+	s := &Store{byID: map[string]*Profile{}, byNumber: map[string]*Profile{}}
+	for _, p := range profiles {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := s.byID[p.ID]; ok {
+			return nil, fmt.Errorf("duplicate agent id %s", p.ID)
+		}
+		s.byID[p.ID] = p
+		for _, number := range p.PhoneNumbers {
+			if other, ok := s.byNumber[number]; ok {
+				return nil, fmt.Errorf("number %s is used by agents %s and %s", number, other.ID, p.ID)
+			}
+			s.byNumber[number] = p
+		}
+	}
+	if _, ok := s.byID[DefaultID]; !ok {
+		s.byID[DefaultID] = Default()
+	}
+	return s, nil
+}
+
+// Load reads profiles from a .yaml, .yml or .json file, or from every such file in a directory.
+// A file holds a single profile or a list of them.
+func Load(path string) (*Store, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = nil
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".yaml", ".yml", ".json":
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+	}
+
+	var profiles []*Profile
+	for _, file := range files {
+		loaded, err := loadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", file, err)
+		}
+		profiles = append(profiles, loaded...)
+	}
+	return NewStore(profiles...)
+}
+
+// loadFile decodes a profile file, YAML is converted to JSON so both share the json tags
+func loadFile(file string) ([]*Profile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		var profiles []*Profile
+		err := json.Unmarshal(data, &profiles)
+		return profiles, err
+	}
+	profile := &Profile{}
+	if err := json.Unmarshal(data, profile); err != nil {
+		return nil, err
+	}
+	return []*Profile{profile}, nil
+}
+
+// Select returns the agent for a call: agentID when it is known, else the agent of the
+// called number, else the default agent
+func (s *Store) Select(agentID, calledNumber string) *Profile {
+	if s == nil {
+		return Default()
+	}
+	if p, ok := s.byID[agentID]; ok {
+		return p
+	}
+	if p, ok := s.byNumber[calledNumber]; ok {
+		return p
+	}
+	return s.byID[DefaultID]
+}
+
+// Profiles returns every agent ordered by id
+func (s *Store) Profiles() []*Profile {
+	if s == nil {
+		return []*Profile{Default()}
+	}
+	profiles := make([]*Profile, 0, len(s.byID))
+	for _, p := range s.byID {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].ID < profiles[j].ID })
+	return profiles
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"twilio-go-stream/internal/tools"
+	"twilio-go-stream/sdk/gcp"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "support.yaml", `
+id: support
+phone_numbers: ["+15550001111"]
+system_prompt: You are support.
+tts: {voice: aura-luna-en}
+timeouts: {silence: 8s}
+tools:
+  - name: check_order
+    url: https://example.com/check
+`)
+	writeFile(t, dir, "sales.json", `[{"id": "sales", "phone_numbers": ["+15550002222"], "greeting": "Hi from sales"}]`)
+	writeFile(t, dir, "notes.txt", "not a profile")
+
+	store, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.Profiles()); n != 3 {
+		t.Fatalf("got %d profiles, want support, sales and default", n)
+	}
+
+	support := store.Select("", "+15550001111")
+	if support.ID != "support" || support.TTS.Voice != "aura-luna-en" || support.Timeouts.Silence.Duration != 8*time.Second {
+		t.Fatalf("unexpected profile %+v", support)
+	}
+	if support.Greeting == "" {
+		t.Fatal("greeting was not defaulted")
+	}
+	registry, err := support.Registry(nil)
+	if err != nil || registry.Len() != 1 {
+		t.Fatalf("registry has %d tools, err %v", registry.Len(), err)
+	}
+
+	if p := store.Select("sales", "+15550001111"); p.ID != "sales" {
+		t.Fatalf("agent_id should win over the called number, got %s", p.ID)
+	}
+	if p := store.Select("unknown", "+15559999999"); p.ID != DefaultID {
+		t.Fatalf("got %s, want the default agent", p.ID)
+	}
+}
+
+func TestNewStoreRejectsDuplicates(t *testing.T) {
+	if _, err := NewStore(&Profile{ID: "a"}, &Profile{ID: "a"}); err == nil {
+		t.Fatal("duplicate ids accepted")
+	}
+	a := &Profile{ID: "a", PhoneNumbers: []string{"+1555"}}
+	b := &Profile{ID: "b", PhoneNumbers: []string{"+1555"}}
+	if _, err := NewStore(a, b); err == nil {
+		t.Fatal("duplicate numbers accepted")
+	}
+	if _, err := NewStore(&Profile{}); err == nil {
+		t.Fatal("profile without id accepted")
+	}
+}
+
+func TestValidateChecksSpeechContexts(t *testing.T) {
+	p := &Profile{ID: "a"}
+	p.STT.SpeechContexts = []gcp.SpeechContext{{Phrases: []string{"Acme"}, Boost: 25}}
+	if err := p.Validate(); err == nil || !strings.Contains(err.Error(), "boost") {
+		t.Fatalf("expected a boost error, got %v", err)
+	}
+	p.STT.SpeechContexts[0].Boost = 5
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateRejectsBuiltinToolNames(t *testing.T) {
+	p := &Profile{ID: "a", Tools: []tools.WebhookConfig{{Name: "hang_up", URL: "http://localhost/hang-up"}}}
+	if err := p.Validate(); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Fatalf("expected a reserved name error, got %v", err)
+	}
+}
+
+func TestGoogleVoiceOverridesServerSettings(t *testing.T) {
+	rate, ssml := 1.25, true
+	tts := TTS{Voice: "en-US-Neural2-F", SpeakingRate: &rate, SSML: &ssml}
+	server := gcp.DefaultTTSConfig()
+	server.Pitch = 2
+	cfg := tts.Google(server)
+	if cfg.Voice != "en-US-Neural2-F" || cfg.SpeakingRate != 1.25 || !cfg.SSML || cfg.Pitch != 2 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	pitch := 30.0
+	p := &Profile{ID: "a", TTS: TTS{Pitch: &pitch}}
+	if err := p.Validate(); err == nil {
+		t.Fatal("pitch 30 accepted")
+	}
+}
+
+func TestSelectWithoutStore(t *testing.T) {
+	var store *Store
+	if p := store.Select("x", "y"); p.ID != DefaultID {
+		t.Fatalf("got %s, want the default agent", p.ID)
+	}
+}
@@ -3,11 +3,10 @@ package audio
 
 import (
 	"encoding/base64"
-	"twilio-go-stream/audio-translation"
-	"twilio-go-stream/internal/interfaces"
+	audio_translator "twilio-go-stream/audio-translation"
 )
 
-// Converter implements the AudioConverter interface
+// Converter converts between PCM16 and μ-law
 type Converter struct{}
 
 // NewConverter creates a new audio converter
@@ -33,4 +32,4 @@ func DecodeBase64Audio(encodedData string) ([]byte, error) {
 // EncodeBase64Audio encodes audio data to base64
 func EncodeBase64Audio(data []byte) string {
 	return base64.StdEncoding.EncodeToString(data)
-}
\ No newline at end of file
+}
@@ -0,0 +1,161 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// FrameSize is 20ms of 8kHz μ-law audio, the packet size Twilio sends and expects
+	FrameSize = 160
+	// FrameDuration is how long one frame plays
+	FrameDuration = 20 * time.Millisecond
+	// DefaultLead is how far ahead of real time audio is sent so Twilio never runs dry
+	DefaultLead = 60 * time.Millisecond
+)
+
+// ErrCleared is returned by Write when Clear dropped the stream it was writing
+var ErrCleared = errors.New("audio stream cleared")
+
+// Clock is the time source of a Pacer, tests use a fake one
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Pacer sends frames at the rate they are played. Frame n of a stream is due at start + n*20ms - lead,
+// so the schedule does not drift however long sending takes, and the first frames fill the lead.
+// When the caller has heard everything sent before the next frame is written the stream underran,
+// the schedule then restarts from the current time.
+type Pacer struct {
+	clock Clock
+	send  func(frame []byte) error
+
+	mu         sync.Mutex
+	lead       time.Duration
+	active     bool      // a stream is being sent, gaps are underruns
+	start      time.Time // when the first frame of the stream was sent
+	sent       int       // frames sent since start
+	paused     bool
+	generation int           // bumped by Clear
+	wake       chan struct{} // closed to wake blocked writers
+	underruns  int
+
+	OnUnderrun func(late time.Duration) // called with how long the caller heard nothing
+}
+
+// NewPacer sends frames with send, a nil clock uses the system clock
+func NewPacer(send func(frame []byte) error, lead time.Duration, clock Clock) *Pacer {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Pacer{clock: clock, send: send, lead: lead, wake: make(chan struct{})}
+}
+
+// SetLead changes how much audio is sent ahead of real time, it applies to the next stream
+func (p *Pacer) SetLead(lead time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lead = lead
+}
+
+// Write blocks until frame is due and sends it. It returns ErrCleared when Clear is called
+// meanwhile and ctx.Err() when ctx is cancelled. Frames are expected from one writer at a time.
+func (p *Pacer) Write(ctx context.Context, frame []byte) error {
+	p.mu.Lock()
+	generation := p.generation
+	for {
+		if p.generation != generation {
+			p.mu.Unlock()
+			return ErrCleared
+		}
+
+		var wait <-chan time.Time
+		if !p.paused {
+			now := p.clock.Now()
+			var late time.Duration
+			if !p.active {
+				p.active, p.start, p.sent = true, now, 0
+			} else if playedOut := p.start.Add(time.Duration(p.sent) * FrameDuration); now.After(playedOut) {
+				late = now.Sub(playedOut)
+				p.underruns++
+				p.start, p.sent = now, 0
+			}
+			if late > 0 && p.OnUnderrun != nil {
+				p.OnUnderrun(late)
+			}
+
+			due := p.start.Add(time.Duration(p.sent)*FrameDuration - p.lead)
+			if !now.Before(due) {
+				// sent under the lock so Clear cannot overtake a frame that is being written
+				p.sent++
+				err := p.send(frame)
+				p.mu.Unlock()
+				return err
+			}
+			wait = p.clock.After(due.Sub(now))
+		}
+
+		wake := p.wake
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wait:
+		case <-wake:
+		}
+		p.mu.Lock()
+	}
+}
+
+// End marks the end of a stream, the silence until the next frame is not an underrun
+func (p *Pacer) End() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active = false
+}
+
+// Pause holds writers until Resume, what was already sent keeps playing
+func (p *Pacer) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = true
+	p.wakeAll()
+}
+
+// Resume lets writers continue, the schedule restarts with a fresh lead
+func (p *Pacer) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = false
+	p.active = false
+	p.wakeAll()
+}
+
+// Clear drops the current stream, blocked writers return ErrCleared
+func (p *Pacer) Clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.generation++
+	p.active = false
+	p.wakeAll()
+}
+
+// Underruns returns how many times the caller ran out of audio in the middle of a stream
+func (p *Pacer) Underruns() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.underruns
+}
+
+func (p *Pacer) wakeAll() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
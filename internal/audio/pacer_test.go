@@ -0,0 +1,221 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when the test advances it
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := make(chan time.Time, 1)
+	f.waiters = append(f.waiters, fakeTimer{at: f.now.Add(d), c: c})
+	return c
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			pending = append(pending, w)
+		} else {
+			w.c <- f.now
+		}
+	}
+	f.waiters = pending
+}
+
+// waitForWaiters blocks until n timers are pending, the writer goroutine is then blocked
+func (f *fakeClock) waitForWaiters(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		count := len(f.waiters)
+		f.mu.Unlock()
+		if count >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("no writer waiting on the clock")
+}
+
+// recorder remembers when each frame was sent
+type recorder struct {
+	mu    sync.Mutex
+	clock *fakeClock
+	times []time.Duration
+}
+
+func (r *recorder) send(frame []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.times = append(r.times, r.clock.Now().Sub(time.Unix(0, 0)))
+	return nil
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.times)
+}
+
+func TestPacerSendsLeadThenRealTime(t *testing.T) {
+	clock := newFakeClock()
+	rec := &recorder{clock: clock}
+	p := NewPacer(rec.send, 40*time.Millisecond, clock)
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 5; i++ {
+			if err := p.Write(context.Background(), make([]byte, FrameSize)); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	// frames 0 to 2 fill the 40ms lead at once, the rest follow every 20ms
+	for i := 0; i < 2; i++ {
+		clock.waitForWaiters(t, 1)
+		clock.Advance(FrameDuration)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{0, 0, 0, 20 * time.Millisecond, 40 * time.Millisecond}
+	for i, at := range rec.times {
+		if at != want[i] {
+			t.Fatalf("frame %d sent at %v, want %v (all %v)", i, at, want[i], rec.times)
+		}
+	}
+	if p.Underruns() != 0 {
+		t.Fatalf("unexpected underruns %d", p.Underruns())
+	}
+}
+
+func TestPacerReportsUnderrun(t *testing.T) {
+	clock := newFakeClock()
+	rec := &recorder{clock: clock}
+	p := NewPacer(rec.send, 0, clock)
+	var late []time.Duration
+	p.OnUnderrun = func(d time.Duration) { late = append(late, d) }
+
+	ctx := context.Background()
+	if err := p.Write(ctx, make([]byte, FrameSize)); err != nil {
+		t.Fatal(err)
+	}
+	// the frame played out after 20ms, the next one comes 50ms later
+	clock.Advance(70 * time.Millisecond)
+	if err := p.Write(ctx, make([]byte, FrameSize)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Underruns() != 1 || len(late) != 1 || late[0] != 50*time.Millisecond {
+		t.Fatalf("expected one 50ms underrun, got %d %v", p.Underruns(), late)
+	}
+
+	// a gap after End is the silence between two streams
+	p.End()
+	clock.Advance(time.Second)
+	if err := p.Write(ctx, make([]byte, FrameSize)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Underruns() != 1 {
+		t.Fatalf("silence after End counted as underrun")
+	}
+}
+
+func TestPacerClearReleasesWriter(t *testing.T) {
+	clock := newFakeClock()
+	rec := &recorder{clock: clock}
+	p := NewPacer(rec.send, 0, clock)
+	ctx := context.Background()
+	if err := p.Write(ctx, make([]byte, FrameSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- p.Write(ctx, make([]byte, FrameSize)) }()
+	clock.waitForWaiters(t, 1)
+	p.Clear()
+	if err := <-done; !errors.Is(err, ErrCleared) {
+		t.Fatalf("expected ErrCleared, got %v", err)
+	}
+	if rec.count() != 1 {
+		t.Fatalf("cleared frame was sent")
+	}
+
+	// the next stream starts right away
+	if err := p.Write(ctx, make([]byte, FrameSize)); err != nil || rec.count() != 2 {
+		t.Fatalf("write after clear: %v, %d frames", err, rec.count())
+	}
+}
+
+func TestPacerPause(t *testing.T) {
+	clock := newFakeClock()
+	rec := &recorder{clock: clock}
+	p := NewPacer(rec.send, 0, clock)
+	p.Pause()
+
+	done := make(chan error)
+	go func() { done <- p.Write(context.Background(), make([]byte, FrameSize)) }()
+	clock.Advance(time.Second)
+	select {
+	case <-done:
+		t.Fatal("frame sent while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	p.Resume()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if rec.count() != 1 || p.Underruns() != 0 {
+		t.Fatalf("expected one frame without underrun, got %d frames %d underruns", rec.count(), p.Underruns())
+	}
+}
+
+func TestPacerStopsOnContext(t *testing.T) {
+	clock := newFakeClock()
+	p := NewPacer(func([]byte) error { return nil }, 0, clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Write(ctx, make([]byte, FrameSize))
+
+	done := make(chan error)
+	go func() { done <- p.Write(ctx, make([]byte, FrameSize)) }()
+	clock.waitForWaiters(t, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+// Package config holds the server settings, read from a YAML/JSON file, the environment and flags
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"twilio-go-stream/internal/audio"
+	"twilio-go-stream/sdk/dectector"
+	"twilio-go-stream/sdk/deepgram"
+	"twilio-go-stream/sdk/gcp"
+	language_processor "twilio-go-stream/sdk/language-processor"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Speech providers
+const (
+	ProviderDeepgram = "deepgram"
+	ProviderGoogle   = "gcp"
+)
+
+type Config struct {
+	Server     Server                    `json:"server"`
+	Twilio     Twilio                    `json:"twilio"`
+	LLM        language_processor.Config `json:"llm"`
+	STT        STT                       `json:"stt"`
+	TTS        TTS                       `json:"tts"`
+	Call       Call                      `json:"call"`
+	Transfer   Transfer                  `json:"transfer"`
+	ToolsFile  string                    `json:"tools_file"`  // JSON list of webhook tools
+	AgentsPath string                    `json:"agents_path"` // agent profile file or directory
+}
+
+type Server struct {
+	PublicURL string `json:"public_url"` // host name Twilio reaches us on, without scheme
+	Port      int    `json:"port"`
+}
+
+type Twilio struct {
+	APIURL            string `json:"api_url"`
+	AccountSid        string `json:"account_sid"`
+	AuthToken         string `json:"auth_token"`
+	ValidateSignature bool   `json:"validate_signature"`
+}
+
+type STT struct {
+	Provider string             `json:"provider"` // deepgram or gcp
+	Deepgram deepgram.STTConfig `json:"deepgram"`
+	Google   gcp.STTConfig      `json:"gcp"`
+}
+
+type TTS struct {
+	Provider string             `json:"provider"` // deepgram or gcp
+	Deepgram deepgram.TTSConfig `json:"deepgram"`
+	Google   gcp.TTSConfig      `json:"gcp"`
+}
+
+// Call settings apply to every call, agent profiles may override them
+type Call struct {
+	MaxDuration       Duration `json:"max_duration"`
+	SilenceTimeout    Duration `json:"silence_timeout"`    // reprompt the caller after this long without speech
+	InterruptCooldown Duration `json:"interrupt_cooldown"` // minimum time between two barge-ins
+	RepromptCooldown  Duration `json:"reprompt_cooldown"`  // minimum time between two silence reprompts
+	DTMFTimeout       Duration `json:"dtmf_timeout"`       // zero keeps the built-in 5s
+	AudioLead         Duration `json:"audio_lead"`         // agent audio sent ahead of real time
+	Farewell          string   `json:"farewell"`           // empty keeps the built-in goodbye
+	RecordDir         string   `json:"record_dir"`         // the agent audio of every call is saved here when set
+}
+
+// Transfer says where callers are transferred, the handler turns it into the call's settings
+type Transfer struct {
+	Target      string   `json:"target"`       // phone number or sip: URI
+	HoldMessage string   `json:"hold_message"` // empty keeps the built-in message
+	Keywords    []string `json:"keywords"`     // unset keeps the built-in phrases, an empty list disables them
+	Whisper     bool     `json:"whisper"`      // read the summary to the human before connecting the caller
+	Webhook     string   `json:"webhook"`      // receives the summary as JSON
+}
+
+// Duration reads durations written as "30s" or "5m"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	return d.Set(s)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Set parses s, it makes Duration a flag.Value
+func (d *Duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Default returns the settings used for anything that is not configured
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			PublicURL: "twilio-go-stream-804663264218.us-central1.run.app",
+			Port:      8080,
+		},
+		Twilio: Twilio{
+			APIURL:            "https://api.twilio.com",
+			ValidateSignature: true,
+		},
+		LLM: language_processor.Config{Provider: language_processor.ProviderGroq},
+		STT: STT{
+			Provider: ProviderDeepgram,
+			Deepgram: deepgram.DefaultSTTConfig(),
+			Google:   gcp.DefaultSTTConfig(),
+		},
+		TTS: TTS{
+			Provider: ProviderDeepgram,
+			Deepgram: deepgram.DefaultTTSConfig(),
+			Google:   gcp.DefaultTTSConfig(),
+		},
+		Call: Call{
+			MaxDuration:       Duration{dectector.MAX_CALL_DURATION},
+			SilenceTimeout:    Duration{dectector.NO_ONE_SPOKE_IN_LAST_X_SEC},
+			InterruptCooldown: Duration{dectector.COOLING_PERIOD_INTRRUPT},
+			RepromptCooldown:  Duration{dectector.COOLING_PERIOD_NO_ONE_SPOKE},
+			AudioLead:         Duration{audio.DefaultLead},
+		},
+		Transfer: Transfer{
+			Whisper: true,
+		},
+	}
+}
+
+// Validate checks every setting and reports all problems at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Server.PublicURL == "" {
+		fail("server.public_url", "is required")
+	} else if strings.Contains(c.Server.PublicURL, "://") || strings.Contains(c.Server.PublicURL, "/") {
+		fail("server.public_url", "must be a host name like voice.example.com, got %q", c.Server.PublicURL)
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		fail("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+
+	if u, err := url.Parse(c.Twilio.APIURL); err != nil || u.Scheme == "" || u.Host == "" {
+		fail("twilio.api_url", "must be an absolute URL, got %q", c.Twilio.APIURL)
+	}
+	if c.Twilio.ValidateSignature && c.Twilio.AuthToken == "" {
+		fail("twilio.auth_token", "is required to verify requests come from Twilio (set TWILIO_AUTH_TOKEN or disable twilio.validate_signature for local development)")
+	}
+
+	// provider settings are checked by the provider registry, see provider.Check
+	providers := []struct {
+		field, name string
+	}{
+		{"llm.provider", c.LLM.Provider},
+		{"stt.provider", c.STT.Provider},
+		{"tts.provider", c.TTS.Provider},
+	}
+	for _, p := range providers {
+		if p.name == "" {
+			fail(p.field, "is required")
+		}
+	}
+
+	durations := []struct {
+		field string
+		value Duration
+	}{
+		{"call.max_duration", c.Call.MaxDuration},
+		{"call.silence_timeout", c.Call.SilenceTimeout},
+		{"call.interrupt_cooldown", c.Call.InterruptCooldown},
+		{"call.reprompt_cooldown", c.Call.RepromptCooldown},
+	}
+	for _, d := range durations {
+		if d.value.Duration <= 0 {
+			fail(d.field, "must be positive, got %s", d.value)
+		}
+	}
+	if c.Call.DTMFTimeout.Duration < 0 {
+		fail("call.dtmf_timeout", "must not be negative, got %s", c.Call.DTMFTimeout)
+	}
+
+	if lead := c.Call.AudioLead.Duration; lead < 0 || lead > time.Second {
+		fail("call.audio_lead", "must be between 0 and 1s, got %s", c.Call.AudioLead)
+	}
+
+	if t := c.Transfer.Target; t != "" && !strings.HasPrefix(t, "+") && !strings.HasPrefix(t, "sip:") {
+		fail("transfer.target", "must be an E.164 number like +15551234567 or a sip: URI, got %q", t)
+	}
+	if w := c.Transfer.Webhook; w != "" {
+		if u, err := url.Parse(w); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			fail("transfer.webhook", "must be an http(s) URL, got %q", w)
+		}
+	}
+
+	if c.ToolsFile != "" {
+		if _, err := os.Stat(c.ToolsFile); err != nil {
+			fail("tools_file", "%v", err)
+		}
+	}
+	if c.Call.RecordDir != "" {
+		if info, err := os.Stat(c.Call.RecordDir); err != nil {
+			fail("call.record_dir", "%v", err)
+		} else if !info.IsDir() {
+			fail("call.record_dir", "%s is not a directory", c.Call.RecordDir)
+		}
+	}
+	if c.AgentsPath != "" {
+		if _, err := os.Stat(c.AgentsPath); err != nil {
+			fail("agents_path", "%v", err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Addr is the address the HTTP server listens on
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Server.Port)
+}
+
+// Dump writes the configuration as YAML with secrets redacted
+func (c *Config) Dump(w io.Writer) error {
+	redacted := *c
+	redacted.Twilio.AuthToken = redact(c.Twilio.AuthToken)
+	redacted.LLM.APIKey = redact(c.LLM.APIKey)
+	redacted.STT.Deepgram.APIKey = redact(c.STT.Deepgram.APIKey)
+	redacted.TTS.Deepgram.APIKey = redact(c.TTS.Deepgram.APIKey)
+
+	// through JSON so the keys are the json tags used when loading
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validEnv sets the secrets every valid configuration needs
+func validEnv(t *testing.T) {
+	t.Setenv("TWILIO_AUTH_TOKEN", "token")
+	t.Setenv("LLM_API_KEY", "llm-key")
+	t.Setenv("DEEPGRAM_API_KEY", "dg-key")
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	validEnv(t)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(`
+server: {public_url: file.example.com, port: 9000}
+stt:
+  provider: gcp
+  gcp: {language: hi-IN}
+call: {max_duration: 10m}
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PUBLIC_URL", "env.example.com")
+	t.Setenv("SILENCE_TIMEOUT", "20s")
+	t.Setenv("TRANSFER_KEYWORDS", "agent, human")
+
+	cfg, args, err := Load([]string{"-config", file, "-port", "9100", "-validate-signature", "dump"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 1 || args[0] != "dump" {
+		t.Fatalf("args = %v", args)
+	}
+	if cfg.Server.PublicURL != "env.example.com" || cfg.Server.Port != 9100 {
+		t.Fatalf("env and flags should win over the file, got %+v", cfg.Server)
+	}
+	if !cfg.Twilio.ValidateSignature {
+		t.Fatal("a bare bool flag should set it")
+	}
+	if cfg.STT.Provider != ProviderGoogle || cfg.STT.Google.Language != "hi-IN" || cfg.STT.Google.SampleRate != 8000 {
+		t.Fatalf("file settings not applied over the defaults: %+v", cfg.STT)
+	}
+	if cfg.Call.MaxDuration.Duration != 10*time.Minute || cfg.Call.SilenceTimeout.Duration != 20*time.Second {
+		t.Fatalf("unexpected call settings %+v", cfg.Call)
+	}
+	if strings.Join(cfg.Transfer.Keywords, "|") != "agent|human" {
+		t.Fatalf("keywords = %q", cfg.Transfer.Keywords)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	validEnv(t)
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(`{"server": {"prot": 80}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load([]string{"-config", file}); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Fatalf("expected an unknown field error, got %v", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := Default()
+	cfg.STT.Provider = ""
+	cfg.Server.PublicURL = "https://voice.example.com"
+	cfg.Transfer.Target = "5551234"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	// provider settings are checked by the provider package
+	for _, field := range []string{"server.public_url", "twilio.auth_token", "stt.provider", "transfer.target"} {
+		if !strings.Contains(err.Error(), field+":") {
+			t.Errorf("missing %s in %v", field, err)
+		}
+	}
+}
+
+func TestDumpRedactsSecrets(t *testing.T) {
+	validEnv(t)
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := cfg.Dump(&sb); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	for _, secret := range []string{"token", "llm-key", "dg-key"} {
+		if strings.Contains(out, ": "+secret+"\n") {
+			t.Fatalf("dump leaks %s:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "max_duration: 4m40s") || !strings.Contains(out, "reprompt_cooldown: 15s") {
+		t.Fatalf("dump misses settings:\n%s", out)
+	}
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	language_processor "twilio-go-stream/sdk/language-processor"
+
+	"gopkg.in/yaml.v3"
+)
+
+// binding ties a setting to its environment variable and, for the common ones, a flag
+type binding struct {
+	env   string
+	flag  string
+	usage string
+	value flag.Value
+}
+
+// bindings lists the settings that can be set from the environment, their names predate the config file
+func (c *Config) bindings() []binding {
+	return []binding{
+		{"PUBLIC_URL", "public-url", "host name Twilio reaches the server on", (*stringValue)(&c.Server.PublicURL)},
+		{"PORT", "port", "HTTP port", (*intValue)(&c.Server.Port)},
+
+		{"TWILIO_API_URL", "", "", (*stringValue)(&c.Twilio.APIURL)},
+		{"TWILIO_ACCOUNT_SID", "", "", (*stringValue)(&c.Twilio.AccountSid)},
+		{"TWILIO_AUTH_TOKEN", "", "", (*stringValue)(&c.Twilio.AuthToken)},
+		{"TWILIO_VALIDATE_SIGNATURE", "validate-signature", "verify X-Twilio-Signature on every request", (*boolValue)(&c.Twilio.ValidateSignature)},
+
+		{"LLM_PROVIDER", "llm", "LLM provider: groq, openai or openai-compatible", (*stringValue)(&c.LLM.Provider)},
+		{"LLM_BASE_URL", "", "", (*stringValue)(&c.LLM.BaseURL)},
+		{"LLM_API_KEY", "", "", (*stringValue)(&c.LLM.APIKey)},
+		{"LLM_MODEL", "llm-model", "default LLM model", (*stringValue)(&c.LLM.Model)},
+
+		{"STT_PROVIDER", "stt", "speech to text provider: deepgram or gcp", (*stringValue)(&c.STT.Provider)},
+		{"TTS_PROVIDER", "tts", "text to speech provider: deepgram or gcp", (*stringValue)(&c.TTS.Provider)},
+		{"DEEPGRAM_API_KEY", "", "", (*stringValue)(&c.STT.Deepgram.APIKey)},
+		{"DEEPGRAM_API_KEY", "", "", (*stringValue)(&c.TTS.Deepgram.APIKey)},
+		{"DEEPGRAM_STT_MODEL", "", "", (*stringValue)(&c.STT.Deepgram.Model)},
+		{"DEEPGRAM_STT_LANGUAGE", "", "", (*stringValue)(&c.STT.Deepgram.Language)},
+		{"DEEPGRAM_STT_KEYWORDS", "", "", (*listValue)(&c.STT.Deepgram.Keywords)},
+		{"DEEPGRAM_TTS_VOICE", "", "", (*stringValue)(&c.TTS.Deepgram.Voice)},
+		{"GOOGLE_STT_LANGUAGE", "", "", (*stringValue)(&c.STT.Google.Language)},
+		{"GOOGLE_STT_MODEL", "", "", (*stringValue)(&c.STT.Google.Model)},
+		{"GOOGLE_STT_ALTERNATIVE_LANGUAGES", "", "", (*listValue)(&c.STT.Google.AlternativeLanguages)},
+		{"GOOGLE_STT_ENHANCED", "", "", (*boolValue)(&c.STT.Google.Enhanced)},
+		{"GOOGLE_TTS_VOICE", "", "", (*stringValue)(&c.TTS.Google.Voice)},
+		{"GOOGLE_TTS_LANGUAGE", "", "", (*stringValue)(&c.TTS.Google.Language)},
+		{"GOOGLE_TTS_SPEAKING_RATE", "", "", (*floatValue)(&c.TTS.Google.SpeakingRate)},
+		{"GOOGLE_TTS_PITCH", "", "", (*floatValue)(&c.TTS.Google.Pitch)},
+		{"GOOGLE_TTS_VOLUME_GAIN_DB", "", "", (*floatValue)(&c.TTS.Google.VolumeGainDb)},
+		{"GOOGLE_TTS_EFFECTS_PROFILE", "", "", (*listValue)(&c.TTS.Google.EffectsProfile)},
+		{"GOOGLE_TTS_SSML", "", "", (*boolValue)(&c.TTS.Google.SSML)},
+
+		{"MAX_CALL_DURATION", "max-call-duration", "calls are ended after this long", &c.Call.MaxDuration},
+		{"SILENCE_TIMEOUT", "", "", &c.Call.SilenceTimeout},
+		{"INTERRUPT_COOLDOWN", "", "", &c.Call.InterruptCooldown},
+		{"REPROMPT_COOLDOWN", "", "", &c.Call.RepromptCooldown},
+		{"DTMF_TIMEOUT", "", "", &c.Call.DTMFTimeout},
+		{"AUDIO_LEAD", "", "", &c.Call.AudioLead},
+		{"FAREWELL_MESSAGE", "", "", (*stringValue)(&c.Call.Farewell)},
+		{"RECORD_DIR", "record-dir", "directory the agent audio of every call is saved in", (*stringValue)(&c.Call.RecordDir)},
+
+		{"TRANSFER_NUMBER", "", "", (*stringValue)(&c.Transfer.Target)},
+		{"TRANSFER_HOLD_MESSAGE", "", "", (*stringValue)(&c.Transfer.HoldMessage)},
+		{"TRANSFER_KEYWORDS", "", "", (*listValue)(&c.Transfer.Keywords)},
+		{"TRANSFER_WHISPER", "", "", (*boolValue)(&c.Transfer.Whisper)},
+		{"TRANSFER_WEBHOOK", "", "", (*stringValue)(&c.Transfer.Webhook)},
+
+		{"TOOLS_FILE", "tools", "JSON file of webhook tools", (*stringValue)(&c.ToolsFile)},
+		{"AGENTS_PATH", "agents", "agent profile file or directory", (*stringValue)(&c.AgentsPath)},
+	}
+}
+
+// Load builds the configuration from the defaults, then the file given with -config (or CONFIG_FILE),
+// then the environment, then the other flags. The remaining command line arguments are returned.
+// A configuration that fails validation is returned along with the error so it can still be dumped.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+	bindings := cfg.bindings()
+
+	fs := flag.NewFlagSet("twilio-go-stream", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON configuration file")
+	flagValues := map[string]*flagValue{}
+	for _, b := range bindings {
+		if b.flag != "" {
+			flagValues[b.flag] = &flagValue{setting: b.value}
+			fs.Var(flagValues[b.flag], b.flag, fmt.Sprintf("%s (env %s)", b.usage, b.env))
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *file != "" {
+		if err := cfg.loadFile(*file); err != nil {
+			return nil, nil, fmt.Errorf("loading %s: %w", *file, err)
+		}
+	}
+
+	for _, b := range bindings {
+		value := os.Getenv(b.env)
+		if value == "" {
+			continue
+		}
+		if err := b.value.Set(value); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s=%q: %w", b.env, value, err)
+		}
+	}
+	if cfg.LLM.APIKey == "" {
+		// provider specific keys are still honoured
+		switch cfg.LLM.Provider {
+		case language_processor.ProviderGroq:
+			cfg.LLM.APIKey = os.Getenv("GROQ_API_KEY")
+		case language_processor.ProviderOpenAI:
+			cfg.LLM.APIKey = os.Getenv("OPENAI_API_KEY")
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, b := range bindings {
+			if b.flag == f.Name && flagErr == nil {
+				if err := b.value.Set(flagValues[f.Name].raw); err != nil {
+					flagErr = fmt.Errorf("invalid -%s: %w", f.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+
+	return cfg, fs.Args(), cfg.Validate()
+}
+
+// loadFile reads a YAML or JSON file over the current settings, YAML is converted to JSON
+// so both formats share the json tags. Unknown keys are rejected to catch typos.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return err
+		}
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	return dec.Decode(c)
+}
+
+// flagValue keeps a flag's value until the environment was applied, so flags win over it.
+// Bool settings are bool flags, a bare -validate-signature means true.
+type flagValue struct {
+	setting flag.Value
+	raw     string
+}
+
+func (f *flagValue) Set(v string) error { f.raw = v; return nil }
+func (f *flagValue) String() string {
+	if f == nil || f.setting == nil {
+		return ""
+	}
+	return f.setting.String()
+}
+func (f *flagValue) IsBoolFlag() bool {
+	_, ok := f.setting.(*boolValue)
+	return ok
+}
+
+type stringValue string
+
+func (s *stringValue) Set(v string) error { *s = stringValue(v); return nil }
+func (s *stringValue) String() string     { return string(*s) }
+
+type intValue int
+
+func (i *intValue) Set(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*i = intValue(n)
+	return nil
+}
+func (i *intValue) String() string { return strconv.Itoa(int(*i)) }
+
+type floatValue float64
+
+func (f *floatValue) Set(v string) error {
+	parsed, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	*f = floatValue(parsed)
+	return nil
+}
+func (f *floatValue) String() string { return strconv.FormatFloat(float64(*f), 'g', -1, 64) }
+
+type boolValue bool
+
+func (b *boolValue) Set(v string) error {
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*b = boolValue(parsed)
+	return nil
+}
+func (b *boolValue) String() string { return strconv.FormatBool(bool(*b)) }
+
+// listValue is a comma separated list
+type listValue []string
+
+func (l *listValue) Set(v string) error {
+	*l = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+func (l *listValue) String() string { return strings.Join(*l, ",") }
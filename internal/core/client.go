@@ -2,26 +2,16 @@ package core
 
 import (
 	"context"
-	"fmt"
+	"io"
 	"sync"
 	"time"
-	audio_translator "twilio-go-stream/audio-translation"
 	"twilio-go-stream/domain"
+	"twilio-go-stream/internal/tools"
 	"twilio-go-stream/sdk/dectector"
-	"twilio-go-stream/sdk/deepgram"
-	"twilio-go-stream/sdk/gcp"
 
 	"github.com/gorilla/websocket"
 )
 
-type TTS interface {
-	GetSpeech(string) ([]byte, error)
-	Speaking(bool)
-	// GetSpeechStreaming is optional and may be implemented for optimized streaming
-}
-type STT interface {
-}
-
 type VAD interface {
 	Start()
 	GetOutputChannel() chan string
@@ -29,21 +19,31 @@ type VAD interface {
 	AgentSpeakChannel() chan bool
 	Stop()
 }
+
+// LanguageProcessor is the LLM backend, the conversation history is owned by the Client
 type LanguageProcessor interface {
-	Chat(string) string
+	// Chat returns the complete reply
+	Chat(ctx context.Context, prompt *domain.Prompt) (domain.Message, error)
+	// ChatStream streams the reply, onDelta receives text as it is generated, cancelling ctx aborts it
+	ChatStream(ctx context.Context, prompt *domain.Prompt, onDelta func(string)) (domain.Message, error)
 }
 
+// DefaultGreeting is said when the call is answered unless the agent has its own
+const DefaultGreeting = "Hello, how can I help you today?"
+
 type Client struct {
-	deepgramSTT  *deepgram.DeepgramSTTCallback
 	prompt       *domain.Prompt
-	deepgram     *deepgram.MyCallback
 	timeSTTEND   time.Time
 	timeTTSStart time.Time
 	timeLLMEND   time.Time
 	wsConn       *websocket.Conn
+	writer       *Writer // every message to Twilio goes through it
 	streamID     string
-	STT          *gcp.GoogleSTTClient
+	callSid      string
+	params       map[string]string
+	stt          STT
 	tts          TTS
+	llm          LanguageProcessor
 	// vad         VAD
 	UserMessage         []string
 	mu                  sync.Mutex
@@ -52,44 +52,133 @@ type Client struct {
 	packetCount         int // Counter for audio packets
 	InterruptAgentSpoke func(bool)
 	Interrupt           *dectector.Interrupt
+	playback            *Playback
+	output              *Output
+	speakingIndex       int   // history index of the assistant turn being spoken
+	turnMessages        []int // history indexes of the assistant messages of the turn, one per tool round
+	tools               *tools.Registry
+	hangUp              bool   // hang_up was called, the call ends after the reply
+	transferring        bool   // transfer_call was called
+	transferReason      string // why the LLM transferred the caller
+	// Transfer redirects the call to cfg.Target and hands summary to the human
+	Transfer       func(ctx context.Context, callSid string, cfg TransferConfig, summary string) error
+	TransferConfig TransferConfig
+	// EndCall completes the call at Twilio, Farewell is said before hanging up on the caller
+	EndCall   func(ctx context.Context, callSid string) error
+	Farewell  string
+	Apology   string // said before hanging up when the speech to text provider cannot recover
+	hangingUp bool
+	closed    bool // the call ended, nothing more is said
+	dtmf      *DTMFCollector
+	Greeting  string // said when the call is answered
 }
 
-func Must(stt *gcp.GoogleSTTClient, tts TTS, deepgram *deepgram.MyCallback, deepgramSTT *deepgram.DeepgramSTTCallback) *Client {
+// Must creates the client of one call, stt must already be started
+func Must(stt STT, tts TTS, llm LanguageProcessor) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 	c := &Client{
-		STT:         stt,
-		tts:         tts,
-		deepgram:    deepgram,
-		prompt:      domain.InitPrompt(),
-		deepgramSTT: deepgramSTT,
-		ctx:         ctx,
-		cancel:      cancel,
+		stt:      stt,
+		tts:      tts,
+		llm:      llm,
+		prompt:   domain.InitPrompt(),
+		ctx:      ctx,
+		cancel:   cancel,
+		Farewell: DefaultFarewell,
+		Apology:  DefaultApology,
+		Greeting: DefaultGreeting,
 	}
 
+	c.dtmf = NewDTMFCollector(c.keypadToLLM)
+
 	interrupt := &dectector.Interrupt{}
-	deepgramSTT.UserSaid.UserSpeaking = interrupt.UserSpoke
 	c.Interrupt = interrupt
 	c.InterruptAgentSpoke = interrupt.AgentSpoke
+	// the agent counts as speaking until Twilio confirms the last sentence was played
+	c.playback = &Playback{OnPlaying: interrupt.AgentSpoke}
 	interrupt.AgentResponse = c.AgentResponse
+	interrupt.OnBargeIn = c.BargeIn
+	interrupt.OnMaxDuration = func() { c.HangUp(c.Farewell) }
+	c.output = NewOutput(c.writeJSON, c.StreamID, c.playback)
+	c.output.OnAudio = c.firstAudio
 
-	// Configure Google STT with the callback approach - similar to Deepgram
-	if stt != nil && deepgramSTT == nil {
-		// Set the callback parameters needed for the GoogleSTT client to call AgentResponse directly
-		stt.AgentResponse = c.AgentResponse
+	return c
+}
 
-		fmt.Println("Google STT configured with direct callback")
+// SetSystemPrompt starts the conversation with the agent's instructions, an empty model
+// leaves the choice to the LLM backend. Instructions of the TTS provider are appended.
+// It must be called before the call starts.
+func (c *Client) SetSystemPrompt(systemPrompt, model string) {
+	if tts, ok := c.tts.(instructedTTS); ok {
+		if instructions := tts.Instructions(); instructions != "" {
+			systemPrompt += "\n\n" + instructions
+		}
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tools := c.prompt.Tools
+	c.prompt = domain.NewPrompt(systemPrompt, model)
+	c.prompt.Tools = tools
+}
 
-	return c
+// RecordAgentAudio copies the μ-law audio the agent sends to the caller to w
+func (c *Client) RecordAgentAudio(w io.Writer) {
+	c.output.Record(w)
+}
+
+// SetAudioLead changes how much agent audio is sent to Twilio ahead of real time
+func (c *Client) SetAudioLead(lead time.Duration) {
+	c.output.SetLead(lead)
 }
 
-// HandleTwilioAudio processes audio data from Twilio for Google STT
-func (c *Client) HandleTwilioAudio(data []byte, stt *gcp.GoogleSTTClient) {
-	// Convert μ-law to PCM16 format that Google STT requires
-	pcm16Data := audio_translator.ConvertMuLawToPCM16(data)
+// SetDTMFTimeout changes how long a keypad entry waits for the next keypress
+func (c *Client) SetDTMFTimeout(timeout time.Duration) {
+	c.dtmf.SetTimeout(timeout)
+}
+
+// Close ends the call on our side: the turn being spoken and its LLM stream are cancelled, the
+// keypad entry is dropped and later replies, including the greeting, are not spoken.
+// It is safe to call more than once.
+func (c *Client) Close() {
+	c.mu.Lock()
+	c.closed = true
+	cancel := c.cancel
+	c.mu.Unlock()
 
-	// Send to Google STT
-	if stt != nil {
-		stt.PushAudioByte(pcm16Data)
+	if cancel != nil {
+		cancel()
 	}
+	c.dtmf.Stop()
+}
+
+// StreamID returns the Twilio streamSid of the call
+func (c *Client) StreamID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streamID
+}
+
+// CallSid returns the Twilio callSid of the call
+func (c *Client) CallSid() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.callSid
+}
+
+// AgentID returns the agent_id <Parameter> sent in the TwiML <Stream>
+func (c *Client) AgentID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.params["agent_id"]
+}
+
+// PlayedUpTo returns the current agent turn and how many of its sentences the caller has heard
+func (c *Client) PlayedUpTo() (turn, sentence int) {
+	return c.playback.PlayedUpTo()
+}
+
+// History returns a copy of the LLM conversation so far
+func (c *Client) History() []domain.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]domain.Message(nil), c.prompt.Messages...)
 }
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"twilio-go-stream/domain"
+)
+
+// Defaults of a keypad entry: digits are collected until # or 5 seconds without a keypress
+const (
+	DefaultDTMFTerminator = "#"
+	DefaultDTMFTimeout    = 5 * time.Second
+)
+
+// DTMFOptions says when a keypad entry is complete
+type DTMFOptions struct {
+	MaxDigits  int           // entry ends after this many digits, 0 for no limit
+	Terminator string        // key ending the entry, it is not part of the digits
+	Timeout    time.Duration // entry ends after this long without a keypress
+}
+
+// DTMFCollector gathers keypresses into entries, OnDigits receives every completed entry
+type DTMFCollector struct {
+	mu       sync.Mutex
+	defaults DTMFOptions // options of entries not requested with Collect
+	opts     DTMFOptions
+	digits   strings.Builder
+	timer    *time.Timer
+	handler  func(string) // one-shot handler set by Collect
+	deliver  sync.Mutex   // keeps handler calls from the read loop and the timeout from overlapping
+	stopped  bool
+
+	OnDigits func(string)
+}
+
+func NewDTMFCollector(onDigits func(string)) *DTMFCollector {
+	defaults := DTMFOptions{Terminator: DefaultDTMFTerminator, Timeout: DefaultDTMFTimeout}
+	return &DTMFCollector{defaults: defaults, opts: defaults, OnDigits: onDigits}
+}
+
+// SetTimeout changes how long an entry waits for the next keypress
+func (d *DTMFCollector) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handler == nil {
+		d.opts.Timeout = timeout
+	}
+	d.defaults.Timeout = timeout
+}
+
+// Collect sends the next entry to handler instead of OnDigits, with its own options. The timeout
+// starts right away, handler gets an empty entry when no digit is entered in time or the
+// terminator is pressed alone.
+func (d *DTMFCollector) Collect(opts DTMFOptions, handler func(string)) {
+	d.mu.Lock()
+	if opts.Timeout == 0 {
+		opts.Timeout = d.defaults.Timeout
+	}
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	d.reset()
+	d.opts = opts
+	d.handler = handler
+	d.arm()
+}
+
+// Stop drops the entry in progress, later keypresses and Collect calls are ignored
+func (d *DTMFCollector) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	d.handler = nil
+	d.reset()
+}
+
+// Push adds a keypress
+func (d *DTMFCollector) Push(digit string) {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	if d.opts.Terminator != "" && digit == d.opts.Terminator {
+		d.finish()
+		return
+	}
+	d.digits.WriteString(digit)
+	if d.opts.MaxDigits > 0 && d.digits.Len() >= d.opts.MaxDigits {
+		d.finish()
+		return
+	}
+
+	d.arm()
+	d.mu.Unlock()
+}
+
+// arm restarts the timeout of the entry, it is called with mu held
+func (d *DTMFCollector) arm() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d.opts.Timeout, func() {
+		d.mu.Lock()
+		if d.timer != timer {
+			// a later keypress restarted the timeout
+			d.mu.Unlock()
+			return
+		}
+		d.finish()
+	})
+	d.timer = timer
+}
+
+// Collecting reports whether an entry is in progress
+func (d *DTMFCollector) Collecting() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.digits.Len() > 0
+}
+
+// finish completes the entry, it is called with mu held and unlocks it before calling the handler
+func (d *DTMFCollector) finish() {
+	digits := d.digits.String()
+	handler := d.OnDigits
+	// a one-shot entry is delivered even when empty, so its handler learns nothing was entered
+	deliver := digits != "" || d.handler != nil
+	if d.handler != nil {
+		handler = d.handler
+	}
+	if deliver {
+		// the entry is done, later ones go to OnDigits with the default options again
+		d.handler = nil
+		d.opts = d.defaults
+	}
+	d.reset()
+	d.mu.Unlock()
+
+	if deliver && handler != nil {
+		d.deliver.Lock()
+		defer d.deliver.Unlock()
+		handler(digits)
+	}
+}
+
+func (d *DTMFCollector) reset() {
+	d.digits.Reset()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
+
+// handleDTMF records a keypress, the caller is active so the silence reprompt is held back
+func (c *Client) handleDTMF(msg *domain.DTMFMessage) {
+	log.Printf("DTMF digit %s received", msg.DTMF.Digit)
+	if c.Interrupt != nil {
+		c.Interrupt.UserActivity()
+	}
+	c.dtmf.Push(msg.DTMF.Digit)
+}
+
+// CollectDigits sends the caller's next keypad entry to handler, e.g. for an account number.
+// handler is called from the media stream read loop, or from a timer goroutine when the entry
+// times out, so it must not block; calls never overlap. digits is empty when nothing was entered
+// before the timeout or only the terminator was pressed. The silence reprompt is paused meanwhile.
+func (c *Client) CollectDigits(opts DTMFOptions, handler func(digits string)) {
+	if c.Interrupt != nil {
+		c.Interrupt.PauseSilence(true)
+	}
+	c.dtmf.Collect(opts, func(digits string) {
+		if c.Interrupt != nil {
+			c.Interrupt.PauseSilence(false)
+		}
+		handler(digits)
+	})
+}
+
+// keypadToLLM gives a keypad entry to the LLM as if the caller had said it, it may run on
+// the media stream read loop so the reply is generated in the background
+func (c *Client) keypadToLLM(digits string) {
+	if digits == "" {
+		go c.AgentResponse(true, "(caller entered no digits on the keypad)")
+		return
+	}
+	go c.AgentResponse(true, "(caller entered on the keypad) "+digits)
+}
+
+// collectDigitsTool lets the LLM ask for a keypad entry, the digits come back as a user message
+func (c *Client) collectDigitsTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var params struct {
+		MaxDigits      int `json:"max_digits"`
+		TimeoutSeconds int `json:"timeout_seconds"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	c.CollectDigits(DTMFOptions{
+		MaxDigits:  params.MaxDigits,
+		Terminator: DefaultDTMFTerminator,
+		Timeout:    time.Duration(params.TimeoutSeconds) * time.Second,
+	}, c.keypadToLLM)
+	return fmt.Sprintf("Waiting for the caller to type on the keypad, ask them to enter the digits followed by %s.", DefaultDTMFTerminator), nil
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDTMFUntilTerminator(t *testing.T) {
+	var entries []string
+	d := NewDTMFCollector(func(digits string) { entries = append(entries, digits) })
+
+	for _, digit := range []string{"1", "2", "3", "#"} {
+		d.Push(digit)
+	}
+	if d.Collecting() || len(entries) != 1 || entries[0] != "123" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	// # on its own is not an entry
+	d.Push("#")
+	if len(entries) != 1 {
+		t.Fatalf("empty entry delivered: %v", entries)
+	}
+}
+
+func TestDTMFCollectDigits(t *testing.T) {
+	var toLLM, account string
+	d := NewDTMFCollector(func(digits string) { toLLM = digits })
+
+	d.Collect(DTMFOptions{MaxDigits: 4}, func(digits string) { account = digits })
+	for _, digit := range []string{"9", "8", "7", "6"} {
+		d.Push(digit)
+	}
+	if account != "9876" || toLLM != "" {
+		t.Fatalf("entry went to the wrong handler: %q %q", account, toLLM)
+	}
+
+	// the one-shot handler is done, the next entry is the default mode again
+	d.Push("5")
+	d.Push("#")
+	if toLLM != "5" || account != "9876" {
+		t.Fatalf("default handler not restored: %q %q", account, toLLM)
+	}
+}
+
+func TestDTMFTimeout(t *testing.T) {
+	done := make(chan string, 1)
+	d := NewDTMFCollector(nil)
+	d.Collect(DTMFOptions{Timeout: 20 * time.Millisecond}, func(digits string) { done <- digits })
+
+	d.Push("4")
+	time.Sleep(10 * time.Millisecond)
+	d.Push("2") // restarts the timeout
+
+	select {
+	case digits := <-done:
+		if digits != "42" {
+			t.Fatalf("unexpected digits %q", digits)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("entry did not time out")
+	}
+}
+
+func TestCollectDigitsPausesSilenceReprompt(t *testing.T) {
+	c := Must(nil, nil, &fakeLLM{})
+	c.Interrupt.SilenceTimeout = time.Millisecond
+	var account string
+	c.CollectDigits(DTMFOptions{MaxDigits: 2}, func(digits string) { account = digits })
+
+	time.Sleep(5 * time.Millisecond)
+	if c.Interrupt.DidNoOneSpokeInLastXSec() {
+		t.Fatal("silence reprompt fired during a keypad entry")
+	}
+	c.dtmf.Push("1")
+	c.dtmf.Push("2")
+	time.Sleep(5 * time.Millisecond)
+	if account != "12" || !c.Interrupt.DidNoOneSpokeInLastXSec() {
+		t.Fatalf("silence reprompt not resumed after the entry %q", account)
+	}
+}
+
+func TestDTMFCollectWithoutKeypress(t *testing.T) {
+	done := make(chan string, 1)
+	d := NewDTMFCollector(nil)
+	d.Collect(DTMFOptions{Timeout: 20 * time.Millisecond}, func(digits string) { done <- digits })
+
+	select {
+	case digits := <-done:
+		if digits != "" {
+			t.Fatalf("unexpected digits %q", digits)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("an entry without keypresses never timed out")
+	}
+}
+
+func TestDTMFCollectTerminatorOnly(t *testing.T) {
+	var toLLM []string
+	var account []string
+	d := NewDTMFCollector(func(digits string) { toLLM = append(toLLM, digits) })
+	d.Collect(DTMFOptions{Terminator: "#"}, func(digits string) { account = append(account, digits) })
+
+	d.Push("#")
+	if len(account) != 1 || account[0] != "" {
+		t.Fatalf("empty entry not delivered: %q", account)
+	}
+	// the one-shot handler was released
+	d.Push("7")
+	d.Push("#")
+	if len(account) != 1 || len(toLLM) != 1 || toLLM[0] != "7" {
+		t.Fatalf("default handler not restored: %q %q", account, toLLM)
+	}
+}
+
+func TestCollectDigitsResumesSilenceRepromptWithoutKeypress(t *testing.T) {
+	c := Must(nil, nil, &fakeLLM{})
+	c.Interrupt.SilenceTimeout = time.Millisecond
+	entered := make(chan string, 1)
+	c.CollectDigits(DTMFOptions{Timeout: 10 * time.Millisecond}, func(digits string) { entered <- digits })
+
+	select {
+	case <-entered:
+	case <-time.After(time.Second):
+		t.Fatal("entry never timed out")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if !c.Interrupt.DidNoOneSpokeInLastXSec() {
+		t.Fatal("silence reprompt still paused after the entry timed out")
+	}
+}
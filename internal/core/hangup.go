@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultFarewell is spoken when the call is ended without the LLM saying goodbye
+const DefaultFarewell = "Thank you for calling, goodbye."
+
+// DefaultApology is spoken when the caller can no longer be heard
+const DefaultApology = "Sorry, I'm having trouble hearing you right now. Please call again later."
+
+// playbackTimeout bounds how long we wait for Twilio to confirm the last sentence was played
+const playbackTimeout = 15 * time.Second
+
+// HangUp ends the call: farewell is spoken (if not empty), then once Twilio confirms the caller
+// heard everything the call is completed through the REST API. Providers are torn down with the
+// session when the media stream stops. Only the first call has an effect.
+func (c *Client) HangUp(farewell string) {
+	c.mu.Lock()
+	if c.hangingUp {
+		c.mu.Unlock()
+		return
+	}
+	c.hangingUp = true
+	callSid := c.callSid
+	c.mu.Unlock()
+	log.Printf("Hanging up call %s", callSid)
+
+	if farewell != "" {
+		c.say(farewell)
+	}
+	c.waitForPlayback()
+
+	if c.EndCall != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := c.EndCall(ctx, callSid); err != nil {
+			log.Printf("Ending call %s failed: %v", callSid, err)
+		}
+	}
+
+	// Twilio sends "stop" once the call is completed, closing the socket covers the case where
+	// the REST call failed so Talk returns and the session is closed either way
+	c.closeWriter()
+	c.mu.Lock()
+	wsConn := c.wsConn
+	c.mu.Unlock()
+	if wsConn != nil {
+		wsConn.Close()
+	}
+}
+
+// HangingUp reports whether the call is being ended
+func (c *Client) HangingUp() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hangingUp
+}
+
+// say speaks text as a turn of its own, it returns once the text was handed to TTS
+func (c *Client) say(text string) {
+	ctx, sentences, index := c.startSpeaking(text)
+	for _, sentence := range splitSentences(text) {
+		select {
+		case sentences <- turnSentence{text: sentence, message: index}:
+		case <-ctx.Done():
+		}
+	}
+	close(sentences)
+}
+
+// waitForPlayback blocks until the caller heard everything the agent said
+func (c *Client) waitForPlayback() {
+	select {
+	case <-c.playback.Idle():
+	case <-time.After(playbackTimeout):
+		log.Println("Timed out waiting for playback to finish")
+	}
+}
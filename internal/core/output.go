@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+	audio_translator "twilio-go-stream/audio-translation"
+	"twilio-go-stream/domain"
+	"twilio-go-stream/internal/audio"
+)
+
+// Output is the single path agent speech takes to the caller. It converts provider audio to μ-law,
+// sends it in 20ms frames paced to real time, follows every sentence with a mark, clears Twilio
+// on barge-in and records what was sent.
+type Output struct {
+	send      func(v interface{}) error
+	streamSid func() string
+	playback  *Playback
+	pacer     *audio.Pacer
+
+	mu        sync.Mutex
+	recorder  io.Writer
+	audioTurn int // last turn that sent audio, set before its frames reach the pacer
+
+	OnAudio func() // called when the first audio of a turn is sent
+}
+
+// NewOutput sends messages with send, streamSid is read when a message is built
+func NewOutput(send func(v interface{}) error, streamSid func() string, playback *Playback) *Output {
+	o := &Output{send: send, streamSid: streamSid, playback: playback}
+	o.pacer = audio.NewPacer(o.sendMedia, audio.DefaultLead, nil)
+	o.pacer.OnUnderrun = func(late time.Duration) {
+		log.Printf("Agent audio underrun, the caller heard %v of silence", late)
+	}
+	return o
+}
+
+// SetLead changes how much audio is sent ahead of real time
+func (o *Output) SetLead(lead time.Duration) {
+	o.pacer.SetLead(lead)
+}
+
+// Record copies every μ-law frame sent to w, nil stops recording
+func (o *Output) Record(w io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.recorder = w
+}
+
+// Play sends the audio of one sentence of turn until the channel is closed, then marks it.
+// It stops early when ctx is cancelled.
+func (o *Output) Play(ctx context.Context, turn int, sentence turnSentence, chunks <-chan domain.AudioChunk) error {
+	var pending, odd []byte
+	for {
+		var chunk domain.AudioChunk
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case chunk, ok = <-chunks:
+		}
+		if !ok {
+			break
+		}
+
+		data := chunk.Data
+		if chunk.Encoding == domain.AudioPCM16 {
+			// a sample may be split across chunks
+			data = append(odd, data...)
+			odd = nil
+			if len(data)%2 == 1 {
+				odd = []byte{data[len(data)-1]}
+				data = data[:len(data)-1]
+			}
+			data = audio_translator.ConvertPCM16ToMuLaw(data)
+		}
+		pending = append(pending, data...)
+
+		for len(pending) >= audio.FrameSize {
+			if err := o.sendFrame(ctx, turn, pending[:audio.FrameSize]); err != nil {
+				return err
+			}
+			pending = pending[audio.FrameSize:]
+		}
+	}
+	if len(pending) > 0 {
+		if err := o.sendFrame(ctx, turn, pending); err != nil {
+			return err
+		}
+	}
+
+	name, ok := o.playback.Sent(turn, sentence)
+	if !ok {
+		return nil
+	}
+	return o.send(domain.NewMarkMessage(o.streamSid(), name))
+}
+
+// sendFrame writes one frame once it is due
+func (o *Output) sendFrame(ctx context.Context, turn int, frame []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	first := o.audioTurn != turn
+	o.audioTurn = turn
+	o.mu.Unlock()
+	if err := o.pacer.Write(ctx, frame); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	if o.recorder != nil {
+		if _, err := o.recorder.Write(frame); err != nil {
+			log.Println("Error recording agent audio:", err)
+			o.recorder = nil
+		}
+	}
+	o.mu.Unlock()
+	if first && o.OnAudio != nil {
+		o.OnAudio()
+	}
+	return nil
+}
+
+func (o *Output) sendMedia(frame []byte) error {
+	return o.send(domain.NewMediaMessage(o.streamSid(), frame))
+}
+
+// End is called once turn was sent, the silence that follows is not an underrun. It is a no-op
+// once a later turn sent audio, the stream then belongs to that turn.
+func (o *Output) End(turn int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.audioTurn > turn {
+		return
+	}
+	o.pacer.End()
+}
+
+// Clear drops the audio Twilio has queued. Playback stops tracking first because Twilio
+// echoes every pending mark when it is cleared.
+func (o *Output) Clear() {
+	o.pacer.Clear()
+	o.playback.Cancel()
+	if err := o.send(domain.NewClearMessage(o.streamSid())); err != nil {
+		log.Println("Error sending clear message:", err)
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+	"twilio-go-stream/domain"
+	"twilio-go-stream/internal/audio"
+)
+
+// fakeTwilio records what an Output sends
+type fakeTwilio struct {
+	frames [][]byte
+	marks  []string
+	clears int
+}
+
+func (f *fakeTwilio) send(v interface{}) error {
+	switch m := v.(type) {
+	case domain.MediaMessage:
+		frame, err := m.Audio()
+		if err != nil {
+			return err
+		}
+		f.frames = append(f.frames, frame)
+	case domain.MarkMessage:
+		f.marks = append(f.marks, m.Mark.Name)
+	case domain.ClearMessage:
+		f.clears++
+	}
+	return nil
+}
+
+func chunks(encoding domain.AudioEncoding, data ...[]byte) <-chan domain.AudioChunk {
+	out := make(chan domain.AudioChunk, len(data))
+	for _, d := range data {
+		out <- domain.AudioChunk{Encoding: encoding, Data: d}
+	}
+	close(out)
+	return out
+}
+
+func TestOutputFramesAndMarksSentences(t *testing.T) {
+	twilio := &fakeTwilio{}
+	playback := &Playback{}
+	o := NewOutput(twilio.send, func() string { return "MZ1" }, playback)
+	o.SetLead(time.Hour)
+	var recording bytes.Buffer
+	o.Record(&recording)
+	firstAudio := 0
+	o.OnAudio = func() { firstAudio++ }
+
+	turn := playback.StartTurn()
+	// 400 bytes arrive in uneven chunks, they are sent as 160, 160 and 80
+	speech := chunks(domain.AudioMuLaw, make([]byte, 100), make([]byte, 250), make([]byte, 50))
+	if err := o.Play(context.Background(), turn, turnSentence{text: "Hello."}, speech); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Play(context.Background(), turn, turnSentence{text: "Bye."}, chunks(domain.AudioMuLaw, make([]byte, 160))); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(twilio.frames) != 4 || len(twilio.frames[0]) != audio.FrameSize || len(twilio.frames[2]) != 80 {
+		t.Fatalf("unexpected frames %d", len(twilio.frames))
+	}
+	if len(twilio.marks) != 2 || twilio.marks[0] != markName(turn, 1) || twilio.marks[1] != markName(turn, 2) {
+		t.Fatalf("unexpected marks %v", twilio.marks)
+	}
+	if recording.Len() != 560 {
+		t.Fatalf("expected 560 recorded bytes, got %d", recording.Len())
+	}
+	if firstAudio != 1 {
+		t.Fatalf("first audio reported %d times", firstAudio)
+	}
+}
+
+func TestOutputConvertsPCM(t *testing.T) {
+	twilio := &fakeTwilio{}
+	playback := &Playback{}
+	o := NewOutput(twilio.send, func() string { return "MZ1" }, playback)
+	o.SetLead(time.Hour)
+
+	// 160 samples split in the middle of one
+	pcm := make([]byte, 320)
+	speech := chunks(domain.AudioPCM16, pcm[:101], pcm[101:])
+	if err := o.Play(context.Background(), playback.StartTurn(), turnSentence{text: "Hi."}, speech); err != nil {
+		t.Fatal(err)
+	}
+	if len(twilio.frames) != 1 || len(twilio.frames[0]) != audio.FrameSize {
+		t.Fatalf("expected one μ-law frame, got %d", len(twilio.frames))
+	}
+}
+
+func TestOutputStopsWhenCancelled(t *testing.T) {
+	twilio := &fakeTwilio{}
+	playback := &Playback{}
+	o := NewOutput(twilio.send, func() string { return "MZ1" }, playback)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	speech := make(chan domain.AudioChunk) // never closed, like a provider that was cut off
+	if err := o.Play(ctx, playback.StartTurn(), turnSentence{text: "Hello."}, speech); err == nil {
+		t.Fatal("expected an error for a cancelled turn")
+	}
+	o.Clear()
+	if len(twilio.frames) != 0 || len(twilio.marks) != 0 || twilio.clears != 1 {
+		t.Fatalf("unexpected messages %d frames %v marks %d clears", len(twilio.frames), twilio.marks, twilio.clears)
+	}
+}
+
+// frozenClock never advances, the pacer sends the lead and then waits forever
+type frozenClock struct{ now time.Time }
+
+func (c frozenClock) Now() time.Time                         { return c.now }
+func (c frozenClock) After(d time.Duration) <-chan time.Time { return make(chan time.Time) }
+
+func TestOutputEndOfOldTurnKeepsNewStream(t *testing.T) {
+	twilio := &fakeTwilio{}
+	playback := &Playback{}
+	o := NewOutput(twilio.send, func() string { return "MZ1" }, playback)
+	o.pacer = audio.NewPacer(o.sendMedia, 3*audio.FrameDuration, frozenClock{time.Now()})
+
+	old := playback.StartTurn()
+	next := playback.StartTurn()
+	// four frames are due at once, the fifth is not due yet
+	for i := 0; i < 4; i++ {
+		if err := o.sendFrame(context.Background(), next, make([]byte, audio.FrameSize)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the old turn's goroutine ends late, it must not restart the new turn's schedule
+	o.End(old)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := o.sendFrame(ctx, next, make([]byte, audio.FrameSize)); err == nil {
+		t.Fatalf("frame sent ahead of schedule, %d frames", len(twilio.frames))
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Playback follows what the caller has actually heard. Every sentence written to Twilio is
+// followed by a mark, Twilio echoes the mark back once the audio before it has been played.
+type Playback struct {
+	mu        sync.Mutex
+	turn      int
+	sentences []turnSentence // sentences of the current turn that were sent to Twilio, in order
+	played    int            // how many of them Twilio confirmed as played
+	finished  bool           // no more sentences will be sent for the current turn
+	cancelled bool           // the turn was cleared, late mark echoes are ignored
+	playing   bool
+	idle      chan struct{} // closed once the caller has heard everything sent
+
+	OnPlaying func(bool) // agent speaking state, driven by confirmed playback
+}
+
+// StartTurn begins a new agent turn, marks of older turns are ignored from now on
+func (p *Playback) StartTurn() int {
+	p.mu.Lock()
+	p.turn++
+	turn := p.turn
+	p.sentences = nil
+	p.played = 0
+	p.finished = false
+	p.cancelled = false
+	p.mu.Unlock()
+
+	p.setPlaying(true)
+	return turn
+}
+
+// Sent records a sentence whose audio was written to Twilio and returns the mark name to send after it.
+// ok is false when the turn is no longer current.
+func (p *Playback) Sent(turn int, sentence turnSentence) (mark string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if turn != p.turn || p.cancelled {
+		return "", false
+	}
+	p.sentences = append(p.sentences, sentence)
+	return markName(turn, len(p.sentences)), true
+}
+
+// FinishTurn is called once all the audio of a turn was sent
+func (p *Playback) FinishTurn(turn int) {
+	p.mu.Lock()
+	if turn != p.turn || p.cancelled {
+		p.mu.Unlock()
+		return
+	}
+	p.finished = true
+	idle := p.played == len(p.sentences)
+	p.mu.Unlock()
+
+	if idle {
+		p.setPlaying(false)
+	}
+}
+
+// Confirm handles a mark echoed by Twilio
+func (p *Playback) Confirm(name string) {
+	var turn, sentence int
+	if _, err := fmt.Sscanf(name, "turn-%d-sentence-%d", &turn, &sentence); err != nil {
+		log.Printf("Ignoring unknown mark %q", name)
+		return
+	}
+
+	p.mu.Lock()
+	if turn != p.turn || p.cancelled || sentence <= p.played {
+		p.mu.Unlock()
+		return
+	}
+	p.played = sentence
+	idle := p.finished && p.played == len(p.sentences)
+	p.mu.Unlock()
+
+	if idle {
+		p.setPlaying(false)
+	}
+}
+
+// Cancel stops tracking the current turn, it must be called before Twilio is sent a clear
+// because Twilio echoes every pending mark when its buffer is cleared
+func (p *Playback) Cancel() {
+	p.mu.Lock()
+	p.cancelled = true
+	p.mu.Unlock()
+
+	p.setPlaying(false)
+}
+
+// PlayedUpTo returns the current turn and how many of its sentences the caller has heard
+func (p *Playback) PlayedUpTo() (turn, sentence int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.turn, p.played
+}
+
+// Heard returns the sentences of the current turn that were played to the caller
+func (p *Playback) Heard() []turnSentence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]turnSentence(nil), p.sentences[:p.played]...)
+}
+
+// Idle returns a channel that is closed once the current turn has been played or cancelled
+func (p *Playback) Idle() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.playing {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return p.idle
+}
+
+// Playing reports whether the caller is still hearing the agent
+func (p *Playback) Playing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.playing
+}
+
+func (p *Playback) setPlaying(playing bool) {
+	p.mu.Lock()
+	changed := p.playing != playing
+	p.playing = playing
+	if changed && playing {
+		p.idle = make(chan struct{})
+	} else if changed {
+		close(p.idle)
+	}
+	p.mu.Unlock()
+
+	if changed && p.OnPlaying != nil {
+		p.OnPlaying(playing)
+	}
+}
+
+func markName(turn, sentence int) string {
+	return fmt.Sprintf("turn-%d-sentence-%d", turn, sentence)
+}
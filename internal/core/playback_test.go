@@ -0,0 +1,127 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"twilio-go-stream/domain"
+	"twilio-go-stream/internal/tools"
+)
+
+func TestPlaybackFollowsMarks(t *testing.T) {
+	var states []bool
+	p := &Playback{OnPlaying: func(b bool) { states = append(states, b) }}
+
+	turn := p.StartTurn()
+	first, _ := p.Sent(turn, turnSentence{text: "Hello."})
+	second, _ := p.Sent(turn, turnSentence{text: "How can I help?"})
+	p.FinishTurn(turn)
+
+	p.Confirm(first)
+	if _, n := p.PlayedUpTo(); n != 1 || !p.Playing() {
+		t.Fatalf("expected 1 sentence played and agent still speaking, got %d %v", n, p.Playing())
+	}
+	p.Confirm(second)
+	if p.Playing() {
+		t.Fatal("agent should stop speaking once the last mark is played")
+	}
+	if len(states) != 2 || !states[0] || states[1] {
+		t.Fatalf("unexpected speaking transitions %v", states)
+	}
+}
+
+func TestPlaybackIgnoresMarksAfterCancel(t *testing.T) {
+	p := &Playback{}
+	turn := p.StartTurn()
+	first, _ := p.Sent(turn, turnSentence{text: "One."})
+	second, _ := p.Sent(turn, turnSentence{text: "Two."})
+	p.Confirm(first)
+
+	p.Cancel()
+	// Twilio echoes pending marks when it is cleared
+	p.Confirm(second)
+
+	heard := p.Heard()
+	if len(heard) != 1 || heard[0].text != "One." {
+		t.Fatalf("expected only the first sentence heard, got %v", heard)
+	}
+	if _, ok := p.Sent(turn, turnSentence{text: "Three."}); ok {
+		t.Fatal("cancelled turn should not accept more sentences")
+	}
+}
+
+func TestPlaybackIdle(t *testing.T) {
+	p := &Playback{}
+	select {
+	case <-p.Idle():
+	default:
+		t.Fatal("playback with nothing sent should be idle")
+	}
+
+	turn := p.StartTurn()
+	mark, _ := p.Sent(turn, turnSentence{text: "Goodbye."})
+	p.FinishTurn(turn)
+	idle := p.Idle()
+	select {
+	case <-idle:
+		t.Fatal("idle before the goodbye was played")
+	default:
+	}
+
+	p.Confirm(mark)
+	select {
+	case <-idle:
+	default:
+		t.Fatal("not idle after the last mark was confirmed")
+	}
+}
+
+func TestNewTurnTruncatesTurnStillPlaying(t *testing.T) {
+	c := Must(nil, nil, &fakeLLM{})
+	ctx, _, index := c.startSpeaking("")
+	turn, _ := c.playback.PlayedUpTo()
+	mark, _ := c.playback.Sent(turn, turnSentence{text: "Your order shipped.", message: index})
+	c.playback.Sent(turn, turnSentence{text: "It arrives on Monday.", message: index})
+	c.playback.Confirm(mark)
+	c.prompt.SetContent(index, "Your order shipped. It arrives on Monday.")
+
+	c.startSpeaking("are you still there?")
+	if ctx.Err() == nil {
+		t.Fatal("the previous turn was not cancelled")
+	}
+	if got := c.prompt.Messages[index].Content; got != "Your order shipped."+domain.InterruptedMarker {
+		t.Fatalf("unexpected history %q", got)
+	}
+}
+
+func TestBargeInTruncatesEachToolRound(t *testing.T) {
+	c := Must(nil, nil, &fakeLLM{})
+	registry := tools.NewRegistry()
+	registry.Func("lookup_order", "Look up an order.", nil, func(ctx context.Context, args json.RawMessage) (string, error) {
+		return "shipped", nil
+	})
+	c.UseTools(registry)
+
+	ctx, _, first := c.startSpeaking("")
+	turn, _ := c.playback.PlayedUpTo()
+	mark, _ := c.playback.Sent(turn, turnSentence{text: "Let me check.", message: first})
+	c.playback.Confirm(mark)
+	c.prompt.SetContent(first, "Let me check.")
+
+	_, second, ok := c.runTools(ctx, first, []domain.ToolCall{{ID: "1", Type: "function", Function: domain.FunctionCall{Name: "lookup_order", Arguments: "{}"}}})
+	if !ok {
+		t.Fatal("tool round was not run")
+	}
+	mark, _ = c.playback.Sent(turn, turnSentence{text: "It shipped.", message: second})
+	c.playback.Sent(turn, turnSentence{text: "It arrives on Monday.", message: second})
+	c.playback.Confirm(mark)
+	c.prompt.SetContent(second, "It shipped. It arrives on Monday.")
+
+	c.BargeIn()
+	if got := c.prompt.Messages[first].Content; got != "Let me check." {
+		t.Fatalf("the first round was heard entirely, got %q", got)
+	}
+	if got := c.prompt.Messages[second].Content; got != "It shipped."+domain.InterruptedMarker {
+		t.Fatalf("unexpected second round %q", got)
+	}
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+)
+
+// isSentenceEnd reports whether r terminates a sentence, including the Hindi danda
+func isSentenceEnd(r rune) bool {
+	switch r {
+	case '.', '?', '!', '।':
+		return true
+	}
+	return false
+}
+
+// markup follows the SSML tags of a reply, sentences are not cut inside a tag or an element
+// because the TTS provider only accepts the markup whole
+type markup struct {
+	tag   []rune // the tag being read, nil outside of one
+	depth int    // elements opened and not closed yet
+}
+
+func (m *markup) push(r rune) {
+	if m.tag == nil {
+		if r == '<' {
+			m.tag = []rune{r}
+		}
+		return
+	}
+	m.tag = append(m.tag, r)
+	if len(m.tag) == 2 && r != '/' && !unicode.IsLetter(r) {
+		// a plain "<" as in "3 < 5"
+		m.tag = nil
+		return
+	}
+	if r != '>' {
+		return
+	}
+	switch {
+	case m.tag[1] == '/':
+		if m.depth > 0 {
+			m.depth--
+		}
+	case m.tag[len(m.tag)-2] != '/':
+		m.depth++
+	}
+	m.tag = nil
+}
+
+// open reports whether the text read so far ends inside a tag or an element
+func (m *markup) open() bool {
+	return m.tag != nil || m.depth > 0
+}
+
+// splitSentences breaks a reply into sentences, a terminator only counts when followed by
+// whitespace or the end of the text so numbers like 3.5 stay intact
+func splitSentences(text string) []string {
+	var sentences []string
+	var sb strings.Builder
+	var m markup
+	runes := []rune(text)
+
+	for i, r := range runes {
+		sb.WriteRune(r)
+		m.push(r)
+		if isSentenceEnd(r) && !m.open() && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])) {
+			if s := strings.TrimSpace(sb.String()); s != "" {
+				sentences = append(sentences, s)
+			}
+			sb.Reset()
+		}
+	}
+	if s := strings.TrimSpace(sb.String()); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// SentenceSegmenter turns streamed LLM text into complete sentences as soon as they are known
+type SentenceSegmenter struct {
+	buf []rune
+}
+
+// Push adds streamed text and returns the sentences it completed
+func (s *SentenceSegmenter) Push(text string) []string {
+	s.buf = append(s.buf, []rune(text)...)
+
+	var sentences []string
+	var m markup
+	start := 0
+	// the last rune is left alone, we need to see what follows a terminator before cutting
+	for i := 0; i+1 < len(s.buf); i++ {
+		m.push(s.buf[i])
+		if isSentenceEnd(s.buf[i]) && !m.open() && unicode.IsSpace(s.buf[i+1]) {
+			if sentence := strings.TrimSpace(string(s.buf[start : i+1])); sentence != "" {
+				sentences = append(sentences, sentence)
+			}
+			start = i + 1
+		}
+	}
+	s.buf = s.buf[start:]
+	return sentences
+}
+
+// Flush returns whatever is left once the stream has ended
+func (s *SentenceSegmenter) Flush() string {
+	rest := strings.TrimSpace(string(s.buf))
+	s.buf = nil
+	return rest
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	got := splitSentences("Hello there! It costs 3.5 dollars. नमस्ते। क्या हाल है? ok")
+	want := []string{"Hello there!", "It costs 3.5 dollars.", "नमस्ते।", "क्या हाल है?", "ok"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSentenceSegmenterStreaming(t *testing.T) {
+	var s SentenceSegmenter
+	var got []string
+	for _, delta := range []string{"Sure", ". It", " costs 3", ".5 dollars", ".", " नमस्ते", "। bye"} {
+		got = append(got, s.Push(delta)...)
+	}
+	want := []string{"Sure.", "It costs 3.5 dollars.", "नमस्ते।"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if rest := s.Flush(); rest != "bye" {
+		t.Fatalf("unexpected remainder %q", rest)
+	}
+}
+
+func TestSentencesKeepSSMLElementsWhole(t *testing.T) {
+	text := `Sure. <prosody rate="slow">Wait. Listen.</prosody> Your code is <say-as interpret-as="characters">A. B</say-as>. Is 3 < 5? Yes.<break time="300ms"/> Bye.`
+	want := []string{
+		"Sure.",
+		`<prosody rate="slow">Wait. Listen.</prosody> Your code is <say-as interpret-as="characters">A. B</say-as>.`,
+		"Is 3 < 5?",
+		`Yes.<break time="300ms"/> Bye.`,
+	}
+	if got := splitSentences(text); !reflect.DeepEqual(got, want) {
+		t.Fatalf("split %q, want %q", got, want)
+	}
+
+	var s SentenceSegmenter
+	var got []string
+	for _, delta := range []string{"Sure. <pros", `ody rate="slow">Wait.`, " Listen.</prosody>", " Ok. Bye"} {
+		got = append(got, s.Push(delta)...)
+	}
+	// the element ends after its terminator, the sentence runs on to the next one
+	want = []string{"Sure.", `<prosody rate="slow">Wait. Listen.</prosody> Ok.`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("segmented %q, want %q", got, want)
+	}
+}
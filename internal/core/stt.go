@@ -1,56 +1,105 @@
-// THIS FILE IS DEPRECATED - Using callback approach instead of channels for Google STT
-// (Twilio) --> μ-law (8kHz) --> [Decode Base64] --> [Convert μ-law to PCM] --> [Send PCM to Google STT] --> [Receive Text]
 package core
 
 import (
+	"context"
 	"fmt"
-	"twilio-go-stream/sdk/gcp"
-	// "time" - removed unused import
+	"log"
+	"strings"
+	"time"
+	"twilio-go-stream/domain"
 )
 
-// DEPRECATED: Routine - No longer used, replaced by callback approach in handleMediaStream
-// We now set callbacks directly on the STT client instead of using channels
-func (c *Client) Routine(sttClient *gcp.GoogleSTTClient) {
-	fmt.Println("DEPRECATED: This function is no longer used. Using callback approach instead.")
-	
-	/* Original implementation kept for reference
-	sttClient.StartStreamingAndAttach()
-	fmt.Println("Listening... Speak now!")
-
-	// Ensure transcription starts before sending audio
-	go sttClient.Transcribe()
-	time.Sleep(100 * time.Millisecond) // Allow STT setup time
-
-	go sttClient.SendAudioInRealTime()
-
-	go func() { //inform vad, adn streo stt data
-		for {
-			// fmt.Println("Running")
-			sttResp := <-sttClient.Result
-			fmt.Println("this be")
-			for _, result := range sttResp.Results {
-				if len(result.Alternatives) == 0 {
-					fmt.Println("Len 0")
-
-				}
-				if result.IsFinal {
-					c.timeSTTEND = time.Now().UTC()
-					fmt.Println("This is final", result.Alternatives[0].Transcript)
-					//todo callback
-					dat := result.Alternatives[0].Transcript
-					c.AgentResponse(true, c.wsConn, dat, c.streamID)
-				}
-				for _, alt := range result.Alternatives {
-					fmt.Printf("\rTranscription: %s\n", alt.Transcript)
-					c.UserMessage = append(c.UserMessage, alt.Transcript)
-					// c.vad.UserSpeakChannel() <- true
-					// c.vad.IsUserSpeaking(true)
-				}
-			}
-			// this does not work, because each time this is called
-			// fmt.Println("User is not speaking")
-			// c.vad.UserSpeakChannel() <- false
+// STT is a streaming speech to text provider
+type STT interface {
+	// Start connects to the provider, events are delivered until ctx is done or Stop is called
+	Start(ctx context.Context) error
+	// Write sends caller audio, μ-law at 8kHz as received from Twilio
+	Write(audio []byte) error
+	// Events returns what the provider heard, the channel is never closed
+	Events() <-chan domain.TranscriptEvent
+	// Stop closes the provider connection
+	Stop()
+}
+
+// endOfTurnDelay ends the caller's turn when the provider sends finals but no UtteranceEnd
+const endOfTurnDelay = 2 * time.Second
+
+// utterance collects the finals of what the caller is saying
+type utterance struct {
+	finals []string
+	last   time.Time // when the caller was last heard
+}
+
+// Push records an event and returns the utterance once the provider says the caller stopped talking
+func (u *utterance) Push(ev domain.TranscriptEvent) (string, bool) {
+	u.last = ev.ReceivedAt
+	switch ev.Type {
+	case domain.TranscriptFinal:
+		u.finals = append(u.finals, ev.Text)
+	case domain.UtteranceEnd:
+		return u.take()
+	}
+	return "", false
+}
+
+// Expire returns the utterance when the caller has not been heard for endOfTurnDelay
+func (u *utterance) Expire(now time.Time) (string, bool) {
+	if now.Sub(u.last) < endOfTurnDelay {
+		return "", false
+	}
+	return u.take()
+}
+
+func (u *utterance) take() (string, bool) {
+	text := strings.TrimSpace(strings.Join(u.finals, " "))
+	u.finals = nil
+	return text, text != ""
+}
+
+// listen turns transcript events into caller turns until ctx is done, partials tell the
+// interrupt detector the caller is talking and every complete utterance is answered
+func (c *Client) listen(ctx context.Context) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var u utterance
+	for {
+		var text string
+		var done bool
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-c.stt.Events():
+			c.onTranscript(ev)
+			text, done = u.Push(ev)
+		case now := <-ticker.C:
+			text, done = u.Expire(now)
+		}
+		if !done {
+			continue
 		}
-	}()
-	*/
-}
\ No newline at end of file
+
+		c.Interrupt.UserSpoke(false)
+		fmt.Println("--------------------------------------------", text)
+		// answered in the background so a barge-in on the reply is still heard
+		go c.AgentResponse(true, text)
+	}
+}
+
+// onTranscript keeps the interrupt detector up to date
+func (c *Client) onTranscript(ev domain.TranscriptEvent) {
+	switch ev.Type {
+	case domain.SpeechStarted:
+		c.Interrupt.UserActivity()
+	case domain.TranscriptPartial:
+		c.Interrupt.UserSpoke(true)
+		fmt.Printf("[Interim Result]: %s %s\n", ev.ReceivedAt, ev.Text)
+	case domain.TranscriptFinal:
+		c.Interrupt.UserSpoke(true)
+		log.Printf("[Final]: %s (confidence %.2f, %v-%v)", ev.Text, ev.Confidence, ev.Start, ev.End)
+	case domain.TranscriptFailed:
+		// the caller can no longer be heard, apologize instead of leaving them in silence
+		log.Println("Speech to text failed, ending the call")
+		go c.HangUp(c.Apology)
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"testing"
+	"time"
+	"twilio-go-stream/domain"
+)
+
+func TestUtteranceEndsOnUtteranceEnd(t *testing.T) {
+	var u utterance
+	now := time.Now()
+	events := []domain.TranscriptEvent{
+		{Type: domain.SpeechStarted, ReceivedAt: now},
+		{Type: domain.TranscriptPartial, Text: "I want", ReceivedAt: now},
+		{Type: domain.TranscriptFinal, Text: "I want to book", ReceivedAt: now},
+		{Type: domain.TranscriptFinal, Text: "a table for two", ReceivedAt: now},
+	}
+	for _, ev := range events {
+		if _, done := u.Push(ev); done {
+			t.Fatalf("utterance ended on %s", ev.Type)
+		}
+	}
+
+	text, done := u.Push(domain.TranscriptEvent{Type: domain.UtteranceEnd, ReceivedAt: now})
+	if !done || text != "I want to book a table for two" {
+		t.Fatalf("got %q, %v", text, done)
+	}
+	// nothing new was said, a second utterance end is not a turn
+	if _, done := u.Push(domain.TranscriptEvent{Type: domain.UtteranceEnd, ReceivedAt: now}); done {
+		t.Fatal("empty utterance answered")
+	}
+}
+
+func TestUtteranceExpiresWithoutUtteranceEnd(t *testing.T) {
+	var u utterance
+	now := time.Now()
+	u.Push(domain.TranscriptEvent{Type: domain.TranscriptFinal, Text: "hello", ReceivedAt: now})
+
+	if _, done := u.Expire(now.Add(endOfTurnDelay / 2)); done {
+		t.Fatal("utterance ended while the caller may still be talking")
+	}
+	// a partial means the caller is still talking
+	u.Push(domain.TranscriptEvent{Type: domain.TranscriptPartial, Text: "hello there", ReceivedAt: now.Add(endOfTurnDelay)})
+	if _, done := u.Expire(now.Add(endOfTurnDelay + time.Second)); done {
+		t.Fatal("utterance ended right after a partial")
+	}
+	if text, done := u.Expire(now.Add(3 * endOfTurnDelay)); !done || text != "hello" {
+		t.Fatalf("got %q, %v", text, done)
+	}
+}
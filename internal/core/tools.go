@@ -0,0 +1,135 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"twilio-go-stream/domain"
+	"twilio-go-stream/internal/tools"
+)
+
+// maxToolRounds bounds how many times one reply can go back to the LLM with tool results
+const maxToolRounds = 3
+
+const (
+	ToolHangUp        = "hang_up"
+	ToolTransferCall  = "transfer_call"
+	ToolCollectDigits = "collect_digits"
+)
+
+// BuiltinTools are the tool names UseTools adds to every call, other tools must not use them
+var BuiltinTools = []string{ToolHangUp, ToolTransferCall, ToolCollectDigits}
+
+// UseTools offers the registry's tools to the LLM, hang_up, transfer_call and collect_digits are added to it
+// as built-ins bound to this call, so the registry must not be shared between calls
+func (c *Client) UseTools(registry *tools.Registry) error {
+	err := registry.Func(ToolHangUp,
+		"End the phone call. Use it once the caller wants to end the conversation, after saying goodbye.",
+		nil,
+		func(ctx context.Context, args json.RawMessage) (string, error) {
+			c.mu.Lock()
+			c.hangUp = true
+			c.mu.Unlock()
+			return "The call will end after your reply, keep the goodbye short.", nil
+		})
+	if err != nil {
+		return err
+	}
+
+	err = registry.Func(ToolTransferCall,
+		"Transfer the caller to a human agent. Use it when the caller asks for a person or you cannot help them.",
+		json.RawMessage(`{"type":"object","properties":{"reason":{"type":"string","description":"Why the caller is transferred"}}}`),
+		func(ctx context.Context, args json.RawMessage) (string, error) {
+			c.mu.Lock()
+			enabled := c.TransferConfig.Enabled()
+			c.mu.Unlock()
+			if c.Transfer == nil || !enabled {
+				return "", fmt.Errorf("transfers are not configured for this line, offer to help the caller yourself")
+			}
+			var params struct {
+				Reason string `json:"reason"`
+			}
+			json.Unmarshal(args, &params)
+
+			c.mu.Lock()
+			c.transferring = true
+			c.transferReason = params.Reason
+			c.mu.Unlock()
+			return "The caller will hear a hold message and be transferred after your reply, say one short sentence at most.", nil
+		})
+	if err != nil {
+		return err
+	}
+
+	err = registry.Func(ToolCollectDigits,
+		"Wait for the caller to type digits on the phone keypad, e.g. an account number or a PIN. The digits are given to you once entered.",
+		json.RawMessage(`{"type":"object","properties":{"max_digits":{"type":"integer","description":"Number of digits to expect, omit to wait for #"},"timeout_seconds":{"type":"integer","description":"Seconds to wait between keypresses"}}}`),
+		c.collectDigitsTool)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.tools = registry
+	c.prompt.Tools = registry.Definitions()
+	c.mu.Unlock()
+	return nil
+}
+
+// runTools records the assistant's tool calls, runs them and appends their results. It returns the
+// prompt to send back to the LLM and the index of the new assistant message for its next reply.
+func (c *Client) runTools(ctx context.Context, index int, calls []domain.ToolCall) (*domain.Prompt, int, bool) {
+	c.mu.Lock()
+	c.prompt.SetToolCalls(index, calls)
+	call := tools.Call{CallSid: c.callSid, StreamSid: c.streamID, AgentID: c.params["agent_id"]}
+	registry := c.tools
+	c.mu.Unlock()
+
+	ctx = tools.WithCall(ctx, call)
+	results := make([]string, len(calls))
+	for i, toolCall := range calls {
+		log.Printf("LLM called %s(%s)", toolCall.Function.Name, toolCall.Function.Arguments)
+		results[i] = registry.Call(ctx, toolCall)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ctx.Err() != nil {
+		// the caller talked over the agent, a newer turn may already follow this message
+		c.prompt.SetToolCalls(index, nil)
+		return nil, index, false
+	}
+	for i, toolCall := range calls {
+		c.prompt.PushToolResult(toolCall, results[i])
+	}
+	request := c.prompt.Clone()
+	c.speakingIndex = c.prompt.PushMessage("assistant", "")
+	c.turnMessages = append(c.turnMessages, c.speakingIndex)
+	return request, c.speakingIndex, true
+}
+
+// afterReply runs the actions the LLM asked for once its reply was generated
+func (c *Client) afterReply(response string) {
+	c.mu.Lock()
+	hangUp := c.hangUp
+	transfer := c.transferring
+	reason := c.transferReason
+	c.transferring = false
+	c.mu.Unlock()
+
+	if transfer {
+		go c.TransferCall(reason)
+		return
+	}
+
+	if hangUp {
+		// hang_up without a goodbye, the farewell is spoken instead
+		farewell := ""
+		if strings.TrimSpace(response) == "" {
+			farewell = c.Farewell
+		}
+		go c.HangUp(farewell)
+	}
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"twilio-go-stream/domain"
+)
+
+// DefaultHoldMessage is spoken while a transfer is being set up
+const DefaultHoldMessage = "Please hold while I connect you to a colleague."
+
+// DefaultTransferKeywords transfer the caller without asking the LLM
+var DefaultTransferKeywords = []string{"real person", "human agent", "representative", "operator", "speak to a person", "talk to a person", "speak to someone", "talk to someone"}
+
+// summaryTimeout bounds the LLM call summarizing the conversation for the human
+const summaryTimeout = 5 * time.Second
+
+// TransferConfig says where callers are transferred and how the human is briefed
+type TransferConfig struct {
+	Target      string   `json:"target"`       // phone number or sip: URI
+	HoldMessage string   `json:"hold_message"` // spoken before the call is redirected
+	Keywords    []string `json:"keywords"`     // caller phrases that transfer without asking the LLM
+	Whisper     bool     `json:"whisper"`      // read the summary to the human before connecting the caller
+	Webhook     string   `json:"webhook"`      // receives the summary as JSON
+}
+
+// Enabled reports whether there is anywhere to transfer callers to
+func (t TransferConfig) Enabled() bool {
+	return t.Target != ""
+}
+
+// TransferCall hands the caller over to a human: the hold message is spoken while the LLM summarizes
+// the call, then once the caller heard it the call is redirected to the target. On failure the caller
+// is told and the conversation goes on.
+func (c *Client) TransferCall(reason string) {
+	c.mu.Lock()
+	cfg := c.TransferConfig
+	if c.hangingUp || c.Transfer == nil || !cfg.Enabled() {
+		c.mu.Unlock()
+		log.Println("Transfer requested but not possible")
+		return
+	}
+	// the agent leaves the call, nothing else is answered from now on
+	c.hangingUp = true
+	callSid := c.callSid
+	history := c.prompt.Clone()
+	c.mu.Unlock()
+	log.Printf("Transferring call %s to %s: %s", callSid, cfg.Target, reason)
+
+	summary := make(chan string, 1)
+	go func() { summary <- c.summarize(history, reason) }()
+
+	// whatever the agent is saying is finished before the hold message
+	c.waitForPlayback()
+	hold := cfg.HoldMessage
+	if hold == "" {
+		hold = DefaultHoldMessage
+	}
+	c.say(hold)
+	c.waitForPlayback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.Transfer(ctx, callSid, cfg, <-summary); err != nil {
+		log.Printf("Transfer of call %s failed: %v", callSid, err)
+		c.mu.Lock()
+		c.hangingUp = false
+		c.mu.Unlock()
+		c.AgentResponse(false, "Sorry, I could not connect you right now.")
+	}
+}
+
+// wantsHuman reports whether the caller asked for a person in so many words
+func (c *Client) wantsHuman(text string) bool {
+	c.mu.Lock()
+	cfg := c.TransferConfig
+	c.mu.Unlock()
+	if !cfg.Enabled() || c.Transfer == nil {
+		return false
+	}
+	return containsKeyword(text, cfg.Keywords)
+}
+
+// containsKeyword matches whole words, case insensitive
+func containsKeyword(text string, keywords []string) bool {
+	text = " " + strings.Join(strings.FieldsFunc(strings.ToLower(text), isSeparator), " ") + " "
+	for _, keyword := range keywords {
+		keyword = strings.Join(strings.FieldsFunc(strings.ToLower(keyword), isSeparator), " ")
+		if keyword != "" && strings.Contains(text, " "+keyword+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func isSeparator(r rune) bool {
+	return r == ' ' || r == ',' || r == '.' || r == '?' || r == '!' || r == '\t' || r == '\n' || r == '।'
+}
+
+// summarize asks the LLM for a short briefing of the call, reason is used if it fails
+func (c *Client) summarize(history *domain.Prompt, reason string) string {
+	fallback := "Transferred call. " + reason
+	transcript := transcript(history.Messages)
+	if c.llm == nil || transcript == "" {
+		return fallback
+	}
+
+	prompt := &domain.Prompt{
+		Model: history.Model,
+		Messages: []domain.Message{
+			{Role: "system", Content: "You brief a human agent who is taking over a phone call from an AI assistant. Summarize who the caller is, what they want and what was already done in at most three short sentences. Plain text only."},
+			{Role: "user", Content: fmt.Sprintf("Reason for the transfer: %s\n\nTranscript:\n%s", reason, transcript)},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+	defer cancel()
+	msg, err := c.llm.Chat(ctx, prompt)
+	if err != nil || strings.TrimSpace(msg.Content) == "" {
+		log.Printf("Summarizing call failed: %v", err)
+		return fallback
+	}
+	return strings.TrimSpace(msg.Content)
+}
+
+// transcript renders what the caller and the agent said, one line per turn
+func transcript(messages []domain.Message) string {
+	var sb strings.Builder
+	for _, m := range messages {
+		if strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		switch m.Role {
+		case "user":
+			sb.WriteString("Caller: ")
+		case "assistant":
+			sb.WriteString("Agent: ")
+		default:
+			continue
+		}
+		sb.WriteString(strings.TrimSpace(m.Content))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
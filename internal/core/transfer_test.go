@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"twilio-go-stream/domain"
+)
+
+func TestContainsKeyword(t *testing.T) {
+	cases := map[string]bool{
+		"Can I talk to a real person please?": true,
+		"REPRESENTATIVE!":                     true,
+		"I want to speak to someone.":         true,
+		"Are you a person":                    false,
+		"The cooperator said no":              false, // "operator" only matches as a word
+	}
+	for text, want := range cases {
+		if got := containsKeyword(text, DefaultTransferKeywords); got != want {
+			t.Errorf("containsKeyword(%q) = %v", text, got)
+		}
+	}
+}
+
+type fakeLLM struct {
+	prompt *domain.Prompt
+	reply  string
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, prompt *domain.Prompt) (domain.Message, error) {
+	f.prompt = prompt
+	return domain.Message{Role: "assistant", Content: f.reply}, nil
+}
+
+func (f *fakeLLM) ChatStream(ctx context.Context, prompt *domain.Prompt, onDelta func(string)) (domain.Message, error) {
+	return f.Chat(ctx, prompt)
+}
+
+func TestSummarize(t *testing.T) {
+	history := domain.InitPrompt()
+	history.PushMessage("user", "My order 42 never arrived.")
+	history.PushMessage("assistant", "I am sorry to hear that.")
+	history.PushMessage("tool", `{"status":"lost"}`)
+
+	llm := &fakeLLM{reply: " Caller's order 42 is lost. "}
+	c := &Client{llm: llm}
+	if got := c.summarize(history, "refund request"); got != "Caller's order 42 is lost." {
+		t.Fatalf("unexpected summary %q", got)
+	}
+
+	sent := llm.prompt.Messages[1].Content
+	if !strings.Contains(sent, "Caller: My order 42 never arrived.\nAgent: I am sorry to hear that.\n") || strings.Contains(sent, "lost") {
+		t.Fatalf("unexpected transcript sent to the LLM: %q", sent)
+	}
+
+	llm.reply = ""
+	if got := c.summarize(history, "refund request"); got != "Transferred call. refund request" {
+		t.Fatalf("expected fallback summary, got %q", got)
+	}
+}
@@ -2,109 +2,76 @@ package core
 
 import (
 	"context"
-	"encoding/base64"
-	"fmt"
 	"log"
-	"time"
-	audio_translator "twilio-go-stream/audio-translation"
+	"twilio-go-stream/domain"
 	"unicode/utf8"
-
-	"github.com/gorilla/websocket"
 )
 
-// StreamGoogleTTS is the main entry point for Google TTS streaming
-func (c *Client) StreamGoogleTTS(ctx context.Context, text, streamSid string, wsConn *websocket.Conn) error {
-	start := time.Now().UTC()
-	fmt.Println("Starting Google TTS streaming at", start)
-
-	// Get the GoogleTTSClient from the interface if possible
-	// googleTTS, ok := c.tts.(*gcp.GoogleTTSClient)
+// TTS is a streaming text to speech provider
+type TTS interface {
+	// Synthesize speaks text, its audio is sent on the returned channel which is closed once
+	// the text is complete. Cancelling ctx stops the synthesis, the channel may then stay open.
+	Synthesize(ctx context.Context, text string) (<-chan domain.AudioChunk, error)
+	Stop()
+}
 
-	// // If we can use the enhanced streaming API, use it
-	// if ok { //tod comment this reduce billing, increse
-	// 	fmt.Println("Using enhanced streaming for GCP TTS")
-	// 	return c.streamGoogleTTSEnhanced(ctx, text, streamSid, wsConn, googleTTS)
-	// }
+// instructedTTS is a TTS with instructions for the LLM, such as the markup it accepts
+type instructedTTS interface {
+	Instructions() string
+}
 
-	// Otherwise fall back to the legacy approach
-	fmt.Println("Using legacy non-streaming for GCP TTS")
-	return c.streamGoogleTTSLegacy(ctx, text, streamSid, wsConn)
+// turnSentence is a sentence of a turn and the index of the assistant message it belongs to,
+// a turn spans several messages when the LLM calls tools
+type turnSentence struct {
+	text    string
+	message int
 }
 
-// Legacy implementation using non-streaming API
-func (c *Client) streamGoogleTTSLegacy(ctx context.Context, text, streamSid string, wsConn *websocket.Conn) error {
-	log.Println("Using legacy GCP TTS (non-streaming)")
-	start := time.Now().UTC()
-	ttsToWs := true
+// synthesizedSentence is a sentence and the audio the provider is producing for it
+type synthesizedSentence struct {
+	turnSentence
+	audio <-chan domain.AudioChunk
+}
 
-	// Get the entire speech in one go
-	ttsResp, err := c.tts.GetSpeech(cleanText(text))
-	if err != nil {
-		fmt.Println("Error getting speech:", err)
-		return err
+// speak synthesizes sentences as they arrive while earlier ones are played, in order
+func (c *Client) speak(ctx context.Context, turn int, sentences <-chan turnSentence) {
+	if c.tts == nil {
+		log.Println("No TTS provider, nothing is spoken")
+		for range sentences {
+		}
+		return
 	}
 
-	audioData := ttsResp
-
-	fmt.Println("Time to speak ==>>>", time.Since(start), time.Now())
-
-	// Convert PCM16 to μ-law (G.711)
-	muLawAudio := audio_translator.ConvertPCM16ToMuLaw(audioData)
-
-	c.InterruptAgentSpoke(true)
-	// Stream Audio to Twilio WebSocket
-	chunkSize := 160 // 20ms of 8kHz μ-law audio = 160 bytes
-
-	log.Println("Streaming μ-law audio to Twilio...")
-	c.tts.Speaking(true)
-
-	for i := 0; i < len(muLawAudio); i += chunkSize {
-		select {
-		case <-ctx.Done():
-			fmt.Println("Stopping old goroutine...")
-			c.tts.Speaking(false)
-			return nil // Exit if context is canceled
-		default:
-			end := i + chunkSize
-			if end > len(muLawAudio) {
-				end = len(muLawAudio)
-			}
-			chunk := muLawAudio[i:end]
-
-			// Encode chunk in Base64
-			payload := base64.StdEncoding.EncodeToString(chunk)
-
-			// Prepare JSON message
-			message := map[string]interface{}{
-				"event":     "media",
-				"streamSid": streamSid,
-				"media": map[string]string{
-					"track":   "audio",
-					"payload": payload,
-				},
+	synthesized := make(chan synthesizedSentence, 4)
+	go func() {
+		defer close(synthesized)
+		for sentence := range sentences {
+			audio, err := c.tts.Synthesize(ctx, cleanText(sentence.text))
+			if err != nil {
+				log.Println("Error synthesizing speech:", err)
+				continue
 			}
-
-			if ttsToWs {
-				fmt.Println("TTS -> WS time in ms ==>>>", time.Since(start), time.Now())
-				ttsToWs = false
+			select {
+			case synthesized <- synthesizedSentence{turnSentence: sentence, audio: audio}:
+			case <-ctx.Done():
+				return
 			}
+		}
+	}()
 
-			// Send message over WebSocket
-			err = wsConn.WriteJSON(message)
-			if err != nil {
-				log.Println("Error sending WebSocket message:", err)
-				return err
+	for sentence := range synthesized {
+		if err := c.output.Play(ctx, turn, sentence.turnSentence, sentence.audio); err != nil {
+			if ctx.Err() != nil {
+				return
 			}
-
-			// Sleep for 16ms to match real-time streaming
-			time.Sleep(16 * time.Millisecond)
+			log.Println("Error playing speech:", err)
+			// the provider may be blocked on the rest of the audio
+			go func(audio <-chan domain.AudioChunk) {
+				for range audio {
+				}
+			}(sentence.audio)
 		}
 	}
-	c.InterruptAgentSpoke(false)
-
-	c.tts.Speaking(false)
-	log.Println("TTS audio streaming completed.")
-	return nil
 }
 
 // cleanText ensures the text is valid UTF-8
@@ -2,38 +2,30 @@ package core
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 	"time"
 	"twilio-go-stream/domain"
-	language_processor "twilio-go-stream/sdk/language-processor"
 
 	"github.com/gorilla/websocket"
 )
 
-func (c *Client) Talk(wsConn *websocket.Conn) {
+// Talk runs the call loop for a stream whose "start" event was already read by the handler
+func (c *Client) Talk(wsConn *websocket.Conn, start *domain.StartMessage) {
 	// Set Ping/Pong handler
 	fmt.Println("Talk")
 	// attach vad
 	// c.vad.Start()
 	fmt.Println("Attached")
 
-	// Configure STT provider with WebSocket and callback
-	if c.deepgramSTT != nil {
-		// Deepgram STT setup
-		c.deepgramSTT.WsConn = wsConn
-		c.deepgramSTT.UserSaid.AgentResponse = c.AgentResponse
-	} else if c.STT != nil {
-		// Google STT setup - use callback approach like Deepgram
-		c.STT.WsConn = wsConn
-		c.STT.Sid = c.streamID // Will be set once we get it
-		// c.STT.AgentResponse is already set in Must()
-		fmt.Println("Using Google STT with callback instead of Deepgram STT")
-	} else {
-		fmt.Println("No STT provider available")
-	}
+	// caller turns are answered until the stream ends
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go c.listen(ctx)
+	defer c.closeWriter()
+	defer c.Close()
 	// fmt.Println("Running Vad")
 
 	// wsConn.SetPingHandler(func(appData string) error {
@@ -41,7 +33,7 @@ func (c *Client) Talk(wsConn *websocket.Conn) {
 	// 	return wsConn.WriteMessage(websocket.PongMessage, nil)
 	// })
 	fmt.Println("Pinging")
-	// c.Routine(c.STT)
+	c.begin(wsConn, start)
 	fmt.Println("Lising audio")
 
 	for {
@@ -53,133 +45,273 @@ func (c *Client) Talk(wsConn *websocket.Conn) {
 		}
 
 		// Parse incoming JSON
-		var stream domain.MediaStream
-		if err := json.Unmarshal(message, &stream); err != nil {
-			log.Println("JSON unmarshal error:", err)
+		msg, err := domain.DecodeMediaStream(message)
+		if err != nil {
+			log.Println("Media stream decode error:", err)
 			continue
 		}
 
-		// Capture Stream SID and start audio sending
-		if stream.Event == "start" && stream.StreamSid != "" {
-			log.Printf("Stream SID received: %s\n", stream.StreamSid)
-			c.streamID = stream.StreamSid
-			c.wsConn = wsConn
-
-			// Set Sid for the active STT provider
-			if c.deepgramSTT != nil {
-				c.deepgramSTT.Sid = stream.StreamSid
-			} else if c.STT != nil {
-				c.STT.Sid = stream.StreamSid
-			}
-
-			go func() {
-				time.Sleep(1 * time.Second)
-				c.AgentResponse(false, "Hello, how can I help you today?")
-				// c.AgentResponse(false, wsConn, "Hello, how can I help you today?", stream.StreamSid)
-				// c.AgentResponse(false, wsConn, "Hello, how can I help you today?", stream.StreamSid)
-				// c.AgentResponse(false, wsConn, "Hello, how can I help you today?", stream.StreamSid)
-				// todo this is practical scenario and system is not able to produce speech properly,
-				// this might be related to 2 words skip issue, this can be solved by remoing context cancelled and using callback or channel instead
-				// c.AgentResponse(false, wsConn, "Hello, how can I help you today?", stream.StreamSid)
-			}()
-
+		switch msg := msg.(type) {
+		case *domain.MediaMessage:
+			c.handleMedia(msg)
+		case *domain.MarkMessage:
+			c.playback.Confirm(msg.Mark.Name)
+		case *domain.DTMFMessage:
+			c.handleDTMF(msg)
+		case *domain.StopMessage:
+			// Handle call stop event
+			log.Printf("Call %s ended, closing WebSocket.", msg.Stop.CallSid)
+			return
+		case *domain.ConnectedMessage, *domain.StartMessage:
+			log.Printf("Ignoring duplicate %s event", msg.EventName())
 		}
+	}
+}
 
-		// Handle incoming audio payload
-		if stream.Event == "media" {
+// handleMedia forwards caller audio to the active STT provider
+func (c *Client) handleMedia(msg *domain.MediaMessage) {
+	if msg.Media.Track != "" && msg.Media.Track != "inbound" {
+		return
+	}
 
-			decodedAudio, err := base64.StdEncoding.DecodeString(stream.Media.Payload)
-			if err != nil {
-				log.Printf("Error decoding audio: %v", err)
-				continue
-			}
+	decodedAudio, err := msg.Audio()
+	if err != nil {
+		log.Printf("Error decoding audio: %v", err)
+		return
+	}
 
-			// Handle audio based on which STT provider is being used
-			if c.deepgramSTT != nil {
-				// Use Deepgram for STT (expects μ-law audio)
-				c.deepgramSTT.PushAudioByte(decodedAudio)
-			} else if c.STT != nil {
-				// Use Google Cloud for STT (requires PCM16 audio)
-				c.HandleTwilioAudio(decodedAudio, c.STT)
-			}
+	// the provider is the same for every packet, so errors are logged occasionally
+	if err := c.stt.Write(decodedAudio); err != nil && c.packetCount%100 == 0 {
+		log.Printf("Error sending audio to STT: %v", err)
+	}
+	c.packetCount++
+}
 
-			// Log occasionally to reduce noise
-			if c.packetCount%100 == 0 {
-				// log.Printf("Processed %d audio packets", c.packetCount)
-			}
-			c.packetCount++
-		}
+// begin captures the Stream SID and greets the caller
+func (c *Client) begin(wsConn *websocket.Conn, start *domain.StartMessage) {
+	c.mu.Lock()
+	c.streamID = start.StreamSid
+	c.callSid = start.Start.CallSid
+	c.params = start.Start.CustomParameters
+	c.wsConn = wsConn
+	c.writer = NewWriter(wsConn, writeTimeout)
+	c.mu.Unlock()
+	log.Printf("Call %s started with agent %q", start.Start.CallSid, start.Param("agent_id"))
 
-		// Handle call stop event
-		if stream.Event == "stop" {
-			log.Println("Call ended, closing WebSocket.")
-			break
-		}
-	}
+	go func() {
+		time.Sleep(1 * time.Second)
+		c.AgentResponse(false, c.Greeting)
+		// todo this is practical scenario and system is not able to produce speech properly,
+		// this might be related to 2 words skip issue, this can be solved by remoing context cancelled and using callback or channel instead
+	}()
 }
 
+// AgentResponse speaks a reply. With genAi the response is the caller's speech, the LLM reply is
+// streamed and every sentence goes to TTS as soon as it is complete.
 func (c *Client) AgentResponse(genAi bool, response string) {
 
 	// message -> gen ai -> tts -> ws
 	start := time.Now().UTC()
 	fmt.Println("User Speech enved at", start)
 
-	if genAi {
-		// Start sending audio
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed || c.HangingUp() {
+		return
+	}
 
+	if !genAi {
+		c.say(response)
+		return
+	}
+
+	if c.wantsHuman(response) {
+		c.mu.Lock()
 		c.prompt.PushMessage("user", response)
+		c.mu.Unlock()
+		go c.TransferCall("The caller asked to speak to a person")
+		return
+	}
 
-		resp := language_processor.GetChatResponseFromGroq(c.prompt)
-		msg := domain.ChatCompletion{}
-		err := json.Unmarshal([]byte(resp), &msg)
-		if err != nil {
-			fmt.Println("Error", err)
-		}
-		if len(msg.Choices) == 0 {
-			fmt.Println("No data from llm")
-			return
+	c.mu.Lock()
+	c.timeSTTEND = start
+	c.prompt.PushMessage("user", response)
+	request := c.prompt.Clone()
+	c.mu.Unlock()
+
+	// the reply is filled in once the stream ends, the placeholder lets a barge-in record what was heard
+	ctx, sentences, index := c.startSpeaking("")
+	speak := func(sentence string) {
+		select {
+		case sentences <- turnSentence{text: sentence, message: index}:
+		case <-ctx.Done():
 		}
-		response = msg.Choices[0].Message.Content
-		c.prompt.PushMessage("system", response)
-		c.timeLLMEND = time.Now().UTC()
-		// fmt.Println("GenAI: ", c.prompt)
-
-		if response == "close()" {
-			// Safely disconnect services that are in use
-			if c.deepgramSTT != nil {
-				c.deepgramSTT.Disconnect()
-			}
-			if c.deepgram != nil {
-				c.deepgram.Disconnect()
+	}
+
+	// tool calls go back to the LLM with their results, what it says meanwhile is spoken
+	var reply domain.Message
+	var err error
+	for round := 0; ; round++ {
+		var segmenter SentenceSegmenter
+		reply, err = c.llm.ChatStream(ctx, request, func(delta string) {
+			for _, sentence := range segmenter.Push(delta) {
+				speak(sentence)
 			}
-			c.wsConn.Close()
+		})
+		if rest := segmenter.Flush(); rest != "" {
+			speak(rest)
+		}
+		c.mu.Lock()
+		// a cancelled turn was already truncated to what the caller heard
+		if ctx.Err() == nil {
+			c.prompt.SetContent(index, reply.Content)
+		}
+		c.mu.Unlock()
+
+		if err != nil || len(reply.ToolCalls) == 0 {
+			break
+		}
+		if round == maxToolRounds {
+			log.Printf("Giving up after %d tool rounds", round)
+			break
+		}
+		var ok bool
+		if request, index, ok = c.runTools(ctx, index, reply.ToolCalls); !ok {
+			break
 		}
 	}
+	close(sentences)
+	response = reply.Content
 
-	// for _,w := range breakSentenceByPunctuators(response) {
+	if err != nil && ctx.Err() == nil {
+		fmt.Println("Error", err)
+	}
+	c.timeLLMEND = time.Now().UTC()
+	if response == "" && len(reply.ToolCalls) == 0 {
+		fmt.Println("No data from llm")
+	}
 
+	c.afterReply(response)
+}
+
+// startSpeaking cancels whatever the agent is saying and starts a new turn, sentences sent on the
+// returned channel are spoken in order until it is closed. text is recorded as the assistant turn.
+func (c *Client) startSpeaking(text string) (context.Context, chan turnSentence, int) {
+	// a turn the caller is still hearing is cut off like a barge-in, so history only keeps what was heard
+	if c.playback.Playing() {
+		heard := c.stopTurn()
+		log.Printf("New turn started, previous turn cut off after %q", heard)
+	}
+
+	c.mu.Lock()
 	// Cancel previous goroutine if it exists
 	if c.cancel != nil {
 		c.cancel()
 	}
-
 	// Create a new context for the new goroutine
 	c.ctx, c.cancel = context.WithCancel(context.Background())
+	ctx := c.ctx
+	if c.closed {
+		// the call ended meanwhile, the turn is over before it starts
+		c.cancel()
+	}
+
+	// everything the agent says is part of the conversation, so an interruption can be recorded against it
+	c.speakingIndex = c.prompt.PushMessage("assistant", text)
+	index := c.speakingIndex
+	c.turnMessages = []int{index}
+	c.mu.Unlock()
+
+	sentences := make(chan turnSentence, 16)
+	turn := c.playback.StartTurn()
+
 	// Start the new goroutine
-	go func(ctx context.Context) {
-		c.timeTTSStart = time.Now().UTC()
-
-		// Use appropriate TTS provider
-		if c.deepgram != nil {
-			// Use Deepgram for TTS
-			c.deepgram.StreamTTSDeepGram(ctx, response, c.wsConn, c.streamID)
-		} else if c.tts != nil {
-			// Use Google Cloud for TTS
-			c.StreamGoogleTTS(ctx, response, c.streamID, c.wsConn)
+	go func() {
+		defer c.playback.FinishTurn(turn)
+		c.speak(ctx, turn, sentences)
+		c.output.End(turn)
+	}()
+
+	return ctx, sentences, index
+}
+
+// firstAudio is called when the first audio byte of a turn is sent to Twilio
+func (c *Client) firstAudio() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeTTSStart = time.Now().UTC()
+	if c.timeSTTEND.IsZero() {
+		return
+	}
+	log.Printf("Latency STT final -> first audio: %v", c.timeTTSStart.Sub(c.timeSTTEND))
+	c.timeSTTEND = time.Time{}
+}
+
+// BargeIn stops the agent as soon as the caller talks over it: cancelling the turn stops the
+// TTS provider and Twilio is told to drop the audio it has queued
+func (c *Client) BargeIn() {
+	heard := c.stopTurn()
+	log.Printf("Barge-in on stream %s, agent playback cleared after %q", c.StreamID(), heard)
+}
+
+// stopTurn cancels the turn being spoken, clears the audio Twilio has queued and truncates the turn
+// in history to the sentences the caller heard, which are returned
+func (c *Client) stopTurn() string {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	c.output.Clear()
+
+	// the LLM should only remember what the caller actually heard. Sentences play in order, so the
+	// messages of the turn before the one last heard from were heard entirely.
+	heard := c.playback.Heard()
+	c.mu.Lock()
+	last := -1
+	if len(heard) > 0 {
+		last = slices.Index(c.turnMessages, heard[len(heard)-1].message)
+	}
+	for i, index := range c.turnMessages {
+		if i >= last {
+			c.prompt.MarkInterrupted(index, joinSentences(heard, index))
+		}
+	}
+	c.mu.Unlock()
+	return joinSentences(heard, -1)
+}
+
+// joinSentences joins the sentences of message, all of them when message is -1
+func joinSentences(sentences []turnSentence, message int) string {
+	var texts []string
+	for _, s := range sentences {
+		if message == -1 || s.message == message {
+			texts = append(texts, s.text)
 		}
+	}
+	return strings.Join(texts, " ")
+}
 
-		fmt.Println("Agent Spoken __ ms after User Stopped", c.timeTTSStart.Sub(c.timeSTTEND))
-	}(c.ctx)
-	// time.Sleep(2 * time.Second)
-	// }
+// writeJSON queues a message to Twilio on the call WebSocket
+func (c *Client) writeJSON(v interface{}) error {
+	c.mu.Lock()
+	writer := c.writer
+	c.mu.Unlock()
+	if writer == nil {
+		return fmt.Errorf("websocket not connected")
+	}
+	return writer.Send(v)
+}
+
+// closeWriter writes what is still queued and stops the writer
+func (c *Client) closeWriter() {
+	c.mu.Lock()
+	writer := c.writer
+	c.mu.Unlock()
+	if writer != nil {
+		writer.Close()
+	}
 }
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"twilio-go-stream/domain"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeSTT hears nothing
+type fakeSTT struct{ events chan domain.TranscriptEvent }
+
+func (f *fakeSTT) Start(ctx context.Context) error       { return nil }
+func (f *fakeSTT) Write(audio []byte) error              { return nil }
+func (f *fakeSTT) Events() <-chan domain.TranscriptEvent { return f.events }
+func (f *fakeSTT) Stop()                                 {}
+
+// streamingLLM streams until its ctx is cancelled
+type streamingLLM struct {
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (f *streamingLLM) Chat(ctx context.Context, prompt *domain.Prompt) (domain.Message, error) {
+	return domain.Message{}, nil
+}
+
+func (f *streamingLLM) ChatStream(ctx context.Context, prompt *domain.Prompt, onDelta func(string)) (domain.Message, error) {
+	close(f.started)
+	<-ctx.Done()
+	close(f.cancelled)
+	return domain.Message{}, ctx.Err()
+}
+
+func TestStreamStopCancelsTurn(t *testing.T) {
+	llm := &streamingLLM{started: make(chan struct{}), cancelled: make(chan struct{})}
+	c := Must(&fakeSTT{events: make(chan domain.TranscriptEvent)}, nil, llm)
+
+	talking := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		start := &domain.StartMessage{StreamSid: "MZ1"}
+		start.Start.CallSid = "CA1"
+		close(talking)
+		c.Talk(conn, start)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-talking
+
+	replied := make(chan struct{})
+	go func() {
+		c.AgentResponse(true, "Where is my order?")
+		close(replied)
+	}()
+	<-llm.started
+
+	if err := conn.WriteJSON(domain.StopMessage{Event: domain.EventStop, StreamSid: "MZ1"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-llm.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the LLM stream outlived the call")
+	}
+	select {
+	case <-replied:
+	case <-time.After(time.Second):
+		t.Fatal("AgentResponse did not return")
+	}
+
+	// the greeting, or anything else, is no longer spoken
+	c.AgentResponse(false, "Hello?")
+	last := c.prompt.Messages[len(c.prompt.Messages)-1]
+	if last.Content == "Hello?" {
+		t.Fatal("a closed client started a turn")
+	}
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+	"twilio-go-stream/domain"
+)
+
+const (
+	// writeTimeout bounds a single write, a connection that stays blocked longer is broken
+	writeTimeout = 5 * time.Second
+	// maxQueuedStream is 10s of audio frames, more means the connection cannot keep up
+	maxQueuedStream = 500
+)
+
+var (
+	ErrWriterClosed = errors.New("websocket writer closed")
+	ErrQueueFull    = errors.New("websocket write queue full")
+)
+
+// Conn is the part of *websocket.Conn the writer uses
+type Conn interface {
+	WriteJSON(v interface{}) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// Writer is the only goroutine writing to a call's WebSocket, gorilla/websocket allows a single
+// concurrent writer. Control messages such as clear jump the queue. Media and marks are written
+// in the order they were sent since Twilio echoes a mark once the audio before it has played.
+type Writer struct {
+	conn    Conn
+	timeout time.Duration
+
+	mu      sync.Mutex
+	control []interface{}
+	stream  []interface{} // media and marks
+	closing bool
+	err     error
+	notify  chan struct{}
+	done    chan struct{}
+}
+
+// NewWriter starts writing to conn
+func NewWriter(conn Conn, timeout time.Duration) *Writer {
+	w := &Writer{
+		conn:    conn,
+		timeout: timeout,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Send queues v without waiting for it to be written. A clear drops the media and marks still
+// queued, Twilio would discard them anyway.
+func (w *Writer) Send(v interface{}) error {
+	w.mu.Lock()
+	switch {
+	case w.err != nil:
+		w.mu.Unlock()
+		return w.err
+	case w.closing:
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+
+	switch v.(type) {
+	case domain.MediaMessage, domain.MarkMessage:
+		if len(w.stream) >= maxQueuedStream {
+			w.mu.Unlock()
+			return ErrQueueFull
+		}
+		w.stream = append(w.stream, v)
+	case domain.ClearMessage:
+		w.stream = nil
+		w.control = append(w.control, v)
+	default:
+		w.control = append(w.control, v)
+	}
+	w.mu.Unlock()
+
+	w.wake()
+	return nil
+}
+
+// Close writes what is queued and stops the writer, the connection is left open
+func (w *Writer) Close() {
+	w.mu.Lock()
+	w.closing = true
+	w.mu.Unlock()
+	w.wake()
+	<-w.done
+}
+
+func (w *Writer) wake() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	for {
+		w.mu.Lock()
+		var msg interface{}
+		switch {
+		case len(w.control) > 0:
+			msg, w.control = w.control[0], w.control[1:]
+		case len(w.stream) > 0:
+			msg, w.stream = w.stream[0], w.stream[1:]
+		}
+		closing := w.closing
+		w.mu.Unlock()
+
+		if msg == nil {
+			if closing {
+				return
+			}
+			<-w.notify
+			continue
+		}
+
+		if err := w.write(msg); err != nil {
+			log.Println("WebSocket write error:", err)
+			w.mu.Lock()
+			w.err = err
+			w.control, w.stream = nil, nil
+			w.mu.Unlock()
+			// the connection is unusable, closing it ends the call loop reading from it
+			w.conn.Close()
+			return
+		}
+	}
+}
+
+func (w *Writer) write(msg interface{}) error {
+	if w.timeout > 0 {
+		if err := w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+			return err
+		}
+	}
+	return w.conn.WriteJSON(msg)
+}
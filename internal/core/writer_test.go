@@ -0,0 +1,147 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"twilio-go-stream/domain"
+)
+
+// fakeConn records writes, the first one blocks until release is closed
+type fakeConn struct {
+	mu        sync.Mutex
+	written   []interface{}
+	deadlines int
+	closed    bool
+	fail      error
+	started   chan struct{}
+	release   chan struct{}
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (f *fakeConn) WriteJSON(v interface{}) error {
+	select {
+	case f.started <- struct{}{}:
+		<-f.release
+	default:
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail != nil {
+		return f.fail
+	}
+	f.written = append(f.written, v)
+	return nil
+}
+
+func (f *fakeConn) SetWriteDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deadlines++
+	return nil
+}
+
+func (f *fakeConn) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeConn) events() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var events []string
+	for _, v := range f.written {
+		switch m := v.(type) {
+		case domain.MediaMessage:
+			events = append(events, "media")
+		case domain.MarkMessage:
+			events = append(events, "mark:"+m.Mark.Name)
+		case domain.ClearMessage:
+			events = append(events, "clear")
+		}
+	}
+	return events
+}
+
+func TestWriterKeepsMarksAfterTheirMedia(t *testing.T) {
+	conn := newFakeConn()
+	w := NewWriter(conn, time.Second)
+
+	w.Send(domain.NewMediaMessage("MZ1", []byte{1}))
+	<-conn.started // the writer is busy, the rest queues up
+	w.Send(domain.NewMediaMessage("MZ1", []byte{2}))
+	w.Send(domain.NewMarkMessage("MZ1", "a"))
+	w.Send(domain.NewMediaMessage("MZ1", []byte{3}))
+	close(conn.release)
+	w.Close()
+
+	got := conn.events()
+	want := []string{"media", "media", "mark:a", "media"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if conn.deadlines != len(want) {
+		t.Fatalf("expected a deadline per write, got %d", conn.deadlines)
+	}
+}
+
+func TestWriterClearJumpsTheQueue(t *testing.T) {
+	conn := newFakeConn()
+	w := NewWriter(conn, time.Second)
+
+	w.Send(domain.NewMediaMessage("MZ1", []byte{1}))
+	<-conn.started
+	w.Send(domain.NewMediaMessage("MZ1", []byte{2}))
+	w.Send(domain.NewMarkMessage("MZ1", "a"))
+	w.Send(domain.NewClearMessage("MZ1"))
+	w.Send(domain.NewMediaMessage("MZ1", []byte{3}))
+	close(conn.release)
+	w.Close()
+
+	// the queued media and mark were cleared before being written
+	got := conn.events()
+	if len(got) != 3 || got[0] != "media" || got[1] != "clear" || got[2] != "media" {
+		t.Fatalf("unexpected writes %v", got)
+	}
+}
+
+func TestWriterStopsOnError(t *testing.T) {
+	conn := newFakeConn()
+	close(conn.release)
+	broken := errors.New("broken pipe")
+	conn.fail = broken
+	w := NewWriter(conn, time.Second)
+
+	w.Send(domain.NewMediaMessage("MZ1", []byte{1}))
+	w.Close()
+	if err := w.Send(domain.NewMarkMessage("MZ1", "a")); !errors.Is(err, broken) {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if !conn.closed {
+		t.Fatal("a broken connection should be closed")
+	}
+}
+
+func TestWriterRejectsAfterClose(t *testing.T) {
+	conn := newFakeConn()
+	close(conn.release)
+	w := NewWriter(conn, time.Second)
+	w.Close()
+	if err := w.Send(domain.NewClearMessage("MZ1")); !errors.Is(err, ErrWriterClosed) {
+		t.Fatalf("expected ErrWriterClosed, got %v", err)
+	}
+	if conn.closed {
+		t.Fatal("Close should leave the connection to its owner")
+	}
+}
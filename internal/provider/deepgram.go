@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"twilio-go-stream/internal/agent"
+	"twilio-go-stream/internal/config"
+	"twilio-go-stream/internal/core"
+	"twilio-go-stream/sdk/deepgram"
+)
+
+// twilioSampleRate is the rate of the μ-law audio Twilio media streams send and play
+const twilioSampleRate = 8000
+
+func init() {
+	RegisterSTT(config.ProviderDeepgram, STTFactory{
+		Settings: []Setting{
+			{Key: "stt.deepgram.api_key", Env: "DEEPGRAM_API_KEY", Required: true, Secret: true},
+			{Key: "stt.deepgram.model", Env: "DEEPGRAM_STT_MODEL", Required: true},
+			{Key: "stt.deepgram.language", Env: "DEEPGRAM_STT_LANGUAGE", Required: true},
+		},
+		Check: func(cfg *config.Config) error {
+			if cfg.STT.Deepgram.SampleRate != twilioSampleRate {
+				return fmt.Errorf("deepgram sample_rate must be %d, Twilio sends 8kHz audio, got %d", twilioSampleRate, cfg.STT.Deepgram.SampleRate)
+			}
+			return nil
+		},
+		New: func(ctx context.Context, cfg *config.Config, profile *agent.Profile) (core.STT, error) {
+			sttConfig := cfg.STT.Deepgram
+			override(&sttConfig.Language, profile.STT.Language)
+			override(&sttConfig.Model, profile.STT.Model)
+			sttConfig.Keywords = slices.Concat(sttConfig.Keywords, profile.STT.Vocabulary)
+			stt := deepgram.InitSTT(sttConfig)
+			if stt == nil {
+				return nil, fmt.Errorf("initializing Deepgram STT")
+			}
+			return stt, nil
+		},
+	})
+
+	RegisterTTS(config.ProviderDeepgram, TTSFactory{
+		Settings: []Setting{
+			{Key: "tts.deepgram.api_key", Env: "DEEPGRAM_API_KEY", Required: true, Secret: true},
+			{Key: "tts.deepgram.voice", Env: "DEEPGRAM_TTS_VOICE", Required: true},
+		},
+		Check: func(cfg *config.Config) error {
+			if tts := cfg.TTS.Deepgram; tts.Encoding != "mulaw" || tts.SampleRate != twilioSampleRate {
+				return fmt.Errorf("deepgram audio must be mulaw at %d Hz for Twilio, got %s at %d Hz", twilioSampleRate, tts.Encoding, tts.SampleRate)
+			}
+			return nil
+		},
+		New: func(ctx context.Context, cfg *config.Config, profile *agent.Profile) (core.TTS, error) {
+			ttsConfig := cfg.TTS.Deepgram
+			override(&ttsConfig.Voice, profile.TTS.Voice)
+			tts := deepgram.Init(ttsConfig)
+			if tts == nil {
+				return nil, fmt.Errorf("initializing Deepgram TTS")
+			}
+			if err := tts.ConnectTTS(); err != nil {
+				tts.Stop()
+				return nil, err
+			}
+			return tts, nil
+		},
+	})
+}
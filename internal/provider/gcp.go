@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"twilio-go-stream/internal/agent"
+	"twilio-go-stream/internal/config"
+	"twilio-go-stream/internal/core"
+	"twilio-go-stream/sdk/gcp"
+)
+
+// googleCredentials is the service account file of Google's client libraries. Without it the
+// libraries use the default credentials of the environment, e.g. the Cloud Run service account.
+var googleCredentials = Setting{Env: "GOOGLE_APPLICATION_CREDENTIALS", Secret: true}
+
+// checkGoogleCredentials fails when a credentials file is configured but cannot be read
+func checkGoogleCredentials() error {
+	path := os.Getenv(googleCredentials.Env)
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %v", googleCredentials.Env, err)
+	}
+	return nil
+}
+
+func init() {
+	RegisterSTT(config.ProviderGoogle, STTFactory{
+		Settings: []Setting{
+			googleCredentials,
+			{Key: "stt.gcp.language", Env: "GOOGLE_STT_LANGUAGE", Required: true},
+			{Key: "stt.gcp.model", Env: "GOOGLE_STT_MODEL"},
+			{Key: "stt.gcp.alternative_languages", Env: "GOOGLE_STT_ALTERNATIVE_LANGUAGES"},
+			{Key: "stt.gcp.enhanced", Env: "GOOGLE_STT_ENHANCED"},
+		},
+		Check: func(cfg *config.Config) error {
+			if cfg.STT.Google.SampleRate != twilioSampleRate {
+				return fmt.Errorf("gcp sample_rate must be %d, Twilio sends 8kHz audio, got %d", twilioSampleRate, cfg.STT.Google.SampleRate)
+			}
+			for _, sc := range cfg.STT.Google.SpeechContexts {
+				if err := sc.Validate(); err != nil {
+					return fmt.Errorf("gcp %w", err)
+				}
+			}
+			return checkGoogleCredentials()
+		},
+		New: func(ctx context.Context, cfg *config.Config, profile *agent.Profile) (core.STT, error) {
+			sttConfig := cfg.STT.Google
+			override(&sttConfig.Language, profile.STT.Language)
+			override(&sttConfig.Model, profile.STT.Model)
+			if len(profile.STT.AlternativeLanguages) > 0 {
+				sttConfig.AlternativeLanguages = profile.STT.AlternativeLanguages
+			}
+			if profile.STT.Enhanced != nil {
+				sttConfig.Enhanced = *profile.STT.Enhanced
+			}
+			// the server's contexts are kept, the agent's add to them
+			sttConfig.SpeechContexts = slices.Concat(sttConfig.SpeechContexts, profile.STT.SpeechContexts)
+			if len(profile.STT.Vocabulary) > 0 {
+				sttConfig.SpeechContexts = append(sttConfig.SpeechContexts, gcp.SpeechContext{Phrases: profile.STT.Vocabulary, Boost: gcp.VocabularyBoost})
+			}
+			stt, err := gcp.NewGoogleSTTClient(sttConfig)
+			if err != nil {
+				return nil, fmt.Errorf("initializing Google STT: %w", err)
+			}
+			return stt, nil
+		},
+	})
+
+	RegisterTTS(config.ProviderGoogle, TTSFactory{
+		Settings: []Setting{
+			googleCredentials,
+			{Key: "tts.gcp.voice", Env: "GOOGLE_TTS_VOICE", Required: true},
+			{Key: "tts.gcp.language", Env: "GOOGLE_TTS_LANGUAGE"},
+			{Key: "tts.gcp.speaking_rate", Env: "GOOGLE_TTS_SPEAKING_RATE"},
+			{Key: "tts.gcp.pitch", Env: "GOOGLE_TTS_PITCH"},
+			{Key: "tts.gcp.volume_gain_db", Env: "GOOGLE_TTS_VOLUME_GAIN_DB"},
+			{Key: "tts.gcp.effects_profile", Env: "GOOGLE_TTS_EFFECTS_PROFILE"},
+			{Key: "tts.gcp.ssml", Env: "GOOGLE_TTS_SSML"},
+		},
+		Check: func(cfg *config.Config) error {
+			if cfg.TTS.Google.SampleRate != twilioSampleRate {
+				return fmt.Errorf("gcp sample_rate must be %d for Twilio, got %d", twilioSampleRate, cfg.TTS.Google.SampleRate)
+			}
+			if err := cfg.TTS.Google.Validate(); err != nil {
+				return fmt.Errorf("gcp %w", err)
+			}
+			return checkGoogleCredentials()
+		},
+		New: func(ctx context.Context, cfg *config.Config, profile *agent.Profile) (core.TTS, error) {
+			ttsConfig := profile.TTS.Google(cfg.TTS.Google)
+			tts, err := gcp.NewGoogleTTSClient(ctx, ttsConfig)
+			if err != nil {
+				return nil, fmt.Errorf("initializing Google TTS: %w", err)
+			}
+			return tts, nil
+		},
+	})
+}
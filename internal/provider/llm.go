@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"twilio-go-stream/internal/config"
+	"twilio-go-stream/internal/core"
+	language_processor "twilio-go-stream/sdk/language-processor"
+)
+
+func init() {
+	// the three backends speak the OpenAI API, language_processor picks the client by provider
+	newLLM := func(cfg *config.Config) (core.LanguageProcessor, error) {
+		return language_processor.New(cfg.LLM)
+	}
+
+	RegisterLLM(language_processor.ProviderGroq, LLMFactory{
+		Settings: []Setting{
+			{Key: "llm.api_key", Env: "LLM_API_KEY or GROQ_API_KEY", Required: true, Secret: true},
+			{Key: "llm.model", Env: "LLM_MODEL"},
+		},
+		New: newLLM,
+	})
+	RegisterLLM(language_processor.ProviderOpenAI, LLMFactory{
+		Settings: []Setting{
+			{Key: "llm.api_key", Env: "LLM_API_KEY or OPENAI_API_KEY", Required: true, Secret: true},
+			{Key: "llm.model", Env: "LLM_MODEL"},
+			{Key: "llm.base_url", Env: "LLM_BASE_URL"},
+		},
+		New: newLLM,
+	})
+	RegisterLLM(language_processor.ProviderOpenAICompatible, LLMFactory{
+		Settings: []Setting{
+			{Key: "llm.base_url", Env: "LLM_BASE_URL", Required: true},
+			{Key: "llm.api_key", Env: "LLM_API_KEY", Secret: true},
+			{Key: "llm.model", Env: "LLM_MODEL"},
+		},
+		New: newLLM,
+	})
+}
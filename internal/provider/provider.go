@@ -0,0 +1,290 @@
+// Package provider builds the speech to text, text to speech and LLM providers by name.
+// Providers register a constructor and the settings it reads, adding one does not touch the handler.
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"twilio-go-stream/internal/agent"
+	"twilio-go-stream/internal/config"
+	"twilio-go-stream/internal/core"
+)
+
+// Setting is one configuration key a provider reads
+type Setting struct {
+	Key      string // path in the config file, e.g. "stt.deepgram.api_key", empty for environment only settings
+	Env      string
+	Required bool
+	Secret   bool
+}
+
+// STTFactory builds the speech to text provider of one call
+type STTFactory struct {
+	Settings []Setting
+	Check    func(cfg *config.Config) error // optional, validates what Settings cannot express
+	New      func(ctx context.Context, cfg *config.Config, profile *agent.Profile) (core.STT, error)
+}
+
+// TTSFactory builds the text to speech provider of one call
+type TTSFactory struct {
+	Settings []Setting
+	Check    func(cfg *config.Config) error
+	New      func(ctx context.Context, cfg *config.Config, profile *agent.Profile) (core.TTS, error)
+}
+
+// LLMFactory builds the LLM backend shared by all calls
+type LLMFactory struct {
+	Settings []Setting
+	Check    func(cfg *config.Config) error
+	New      func(cfg *config.Config) (core.LanguageProcessor, error)
+}
+
+var (
+	mu   sync.RWMutex
+	stts = map[string]STTFactory{}
+	ttss = map[string]TTSFactory{}
+	llms = map[string]LLMFactory{}
+)
+
+// RegisterSTT makes a speech to text provider available as stt.provider: name
+func RegisterSTT(name string, f STTFactory) {
+	register(stts, "STT", name, f)
+}
+
+// RegisterTTS makes a text to speech provider available as tts.provider: name
+func RegisterTTS(name string, f TTSFactory) {
+	register(ttss, "TTS", name, f)
+}
+
+// RegisterLLM makes an LLM backend available as llm.provider: name
+func RegisterLLM(name string, f LLMFactory) {
+	register(llms, "LLM", name, f)
+}
+
+func register[F any](factories map[string]F, kind, name string, f F) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("provider: %s provider %s registered twice", kind, name))
+	}
+	factories[name] = f
+}
+
+// NewSTT builds the speech to text provider name for a call answered by profile
+func NewSTT(ctx context.Context, name string, cfg *config.Config, profile *agent.Profile) (core.STT, error) {
+	f, err := lookup(stts, "STT", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.New(ctx, cfg, profile)
+}
+
+// NewTTS builds the text to speech provider name for a call answered by profile
+func NewTTS(ctx context.Context, name string, cfg *config.Config, profile *agent.Profile) (core.TTS, error) {
+	f, err := lookup(ttss, "TTS", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.New(ctx, cfg, profile)
+}
+
+// NewLLM builds the LLM backend name
+func NewLLM(name string, cfg *config.Config) (core.LanguageProcessor, error) {
+	f, err := lookup(llms, "LLM", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.New(cfg)
+}
+
+func lookup[F any](factories map[string]F, kind, name string) (F, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := factories[name]
+	if !ok {
+		return f, fmt.Errorf("unknown %s provider %q (available: %s)", kind, name, strings.Join(names(factories), ", "))
+	}
+	return f, nil
+}
+
+// STTProviders lists the registered speech to text providers
+func STTProviders() []string { return list(stts) }
+
+// TTSProviders lists the registered text to speech providers
+func TTSProviders() []string { return list(ttss) }
+
+// LLMProviders lists the registered LLM backends
+func LLMProviders() []string { return list(llms) }
+
+func list[F any](factories map[string]F) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return names(factories)
+}
+
+func names[F any](factories map[string]F) []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check verifies the configured providers exist, their required settings are present and
+// their own checks pass. Every problem is reported, formatted like config.Validate.
+func Check(cfg *config.Config) error {
+	values, err := flatten(cfg)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	check := func(kind, name string, available []string, found bool, settings []Setting, extra func(*config.Config) error) {
+		if !found {
+			errs = append(errs, fmt.Errorf("%s.provider: unknown provider %q (available: %s)", kind, name, strings.Join(available, ", ")))
+			return
+		}
+		for _, s := range settings {
+			if !s.Required || s.Key == "" {
+				continue
+			}
+			if v, ok := values[s.Key]; !ok || isZero(v) {
+				hint := ""
+				if s.Env != "" {
+					hint = fmt.Sprintf(" (set %s)", s.Env)
+				}
+				errs = append(errs, fmt.Errorf("%s: is required by the %s provider%s", s.Key, name, hint))
+			}
+		}
+		if extra != nil {
+			if err := extra(cfg); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", kind, err))
+			}
+		}
+	}
+
+	mu.RLock()
+	stt, sttOK := stts[cfg.STT.Provider]
+	tts, ttsOK := ttss[cfg.TTS.Provider]
+	llm, llmOK := llms[cfg.LLM.Provider]
+	mu.RUnlock()
+	check("stt", cfg.STT.Provider, STTProviders(), sttOK, stt.Settings, stt.Check)
+	check("tts", cfg.TTS.Provider, TTSProviders(), ttsOK, tts.Settings, tts.Check)
+	check("llm", cfg.LLM.Provider, LLMProviders(), llmOK, llm.Settings, llm.Check)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid provider configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Describe writes every registered provider and the settings it reads, the configured providers
+// are marked with * and secrets are only reported as set or missing
+func Describe(w io.Writer, cfg *config.Config) error {
+	values, err := flatten(cfg)
+	if err != nil {
+		return err
+	}
+	section := func(kind, configured string, providers []string, settings func(string) []Setting) {
+		fmt.Fprintf(w, "%s providers:\n", kind)
+		for _, name := range providers {
+			mark := " "
+			if name == configured {
+				mark = "*"
+			}
+			fmt.Fprintf(w, "  %s %s\n", mark, name)
+			for _, s := range settings(name) {
+				fmt.Fprintf(w, "      %s\n", describeSetting(s, values))
+			}
+		}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	section("STT", cfg.STT.Provider, names(stts), func(name string) []Setting { return stts[name].Settings })
+	section("TTS", cfg.TTS.Provider, names(ttss), func(name string) []Setting { return ttss[name].Settings })
+	section("LLM", cfg.LLM.Provider, names(llms), func(name string) []Setting { return llms[name].Settings })
+	return nil
+}
+
+func describeSetting(s Setting, values map[string]interface{}) string {
+	var value interface{}
+	var set bool
+	name := s.Key
+	if s.Key == "" {
+		name = s.Env
+		value = os.Getenv(s.Env)
+		set = value != ""
+	} else {
+		value = values[s.Key]
+		set = !isZero(value)
+		if s.Env != "" {
+			name += " (" + s.Env + ")"
+		}
+	}
+
+	state := "not set"
+	switch {
+	case set && s.Secret:
+		state = "set"
+	case set:
+		state = fmt.Sprint(value)
+	case s.Required:
+		state = "missing, required"
+	}
+	return fmt.Sprintf("%s: %s", name, state)
+}
+
+// flatten maps the dotted keys of the config file to their values
+func flatten(cfg *config.Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		if m, ok := v.(map[string]interface{}); ok {
+			for k, child := range m {
+				walk(strings.TrimPrefix(prefix+"."+k, "."), child)
+			}
+			return
+		}
+		values[prefix] = v
+	}
+	walk("", doc)
+	return values, nil
+}
+
+func isZero(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// override replaces the server setting with the agent's when the agent has one
+func override(setting *string, agentValue string) {
+	if agentValue != "" {
+		*setting = agentValue
+	}
+}
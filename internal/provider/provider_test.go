@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"twilio-go-stream/internal/agent"
+	"twilio-go-stream/internal/config"
+	"twilio-go-stream/internal/core"
+)
+
+func TestCheckReportsProviderProblems(t *testing.T) {
+	cfg := config.Default()
+	cfg.STT.Provider = "whisper"
+	cfg.TTS.Deepgram.APIKey = ""
+	cfg.LLM.APIKey = ""
+
+	err := Check(cfg)
+	if err == nil {
+		t.Fatal("invalid provider configuration accepted")
+	}
+	for _, want := range []string{`stt.provider: unknown provider "whisper" (available: `, "tts.deepgram.api_key:", "llm.api_key:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in %v", want, err)
+		}
+	}
+
+	cfg.STT.Provider = config.ProviderDeepgram
+	cfg.STT.Deepgram.APIKey = "dg-key"
+	cfg.TTS.Deepgram.APIKey = "dg-key"
+	cfg.LLM.APIKey = "llm-key"
+	if err := Check(cfg); err != nil {
+		t.Fatalf("valid configuration rejected: %v", err)
+	}
+
+	cfg.TTS.Deepgram.Encoding = "linear16"
+	if err := Check(cfg); err == nil || !strings.Contains(err.Error(), "tts: deepgram audio must be mulaw") {
+		t.Fatalf("expected the provider's own check to fail, got %v", err)
+	}
+}
+
+// fakeSTT is a provider registered by the test
+type fakeSTT struct {
+	core.STT
+	language string
+}
+
+func TestRegisteredProviderIsBuiltByName(t *testing.T) {
+	RegisterSTT("fake", STTFactory{
+		Settings: []Setting{{Key: "stt.gcp.language", Required: true}},
+		New: func(ctx context.Context, cfg *config.Config, profile *agent.Profile) (core.STT, error) {
+			language := cfg.STT.Google.Language
+			override(&language, profile.STT.Language)
+			return &fakeSTT{language: language}, nil
+		},
+	})
+
+	found := false
+	for _, name := range STTProviders() {
+		found = found || name == "fake"
+	}
+	if !found {
+		t.Fatalf("fake missing from %v", STTProviders())
+	}
+
+	profile := agent.Default()
+	profile.STT.Language = "hi-IN"
+	stt, err := NewSTT(context.Background(), "fake", config.Default(), profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stt.(*fakeSTT).language != "hi-IN" {
+		t.Fatalf("agent language not used, got %q", stt.(*fakeSTT).language)
+	}
+
+	if _, err := NewSTT(context.Background(), "whisper", config.Default(), profile); err == nil {
+		t.Fatal("unknown provider built")
+	}
+}
+
+func TestDescribeHidesSecrets(t *testing.T) {
+	cfg := config.Default()
+	cfg.STT.Deepgram.APIKey = "dg-secret"
+	var sb strings.Builder
+	if err := Describe(&sb, cfg); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	if strings.Contains(out, "dg-secret") {
+		t.Fatalf("secret in listing:\n%s", out)
+	}
+	if !strings.Contains(out, "* deepgram") || !strings.Contains(out, "stt.deepgram.api_key (DEEPGRAM_API_KEY): set") {
+		t.Fatalf("unexpected listing:\n%s", out)
+	}
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Manager is the registry of live sessions keyed by streamSid, lookups also accept the callSid
+type Manager struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+func NewManager() *Manager {
+	return &Manager{sessions: make(map[string]*Session)}
+}
+
+// Add registers a session, a streamSid can only be live once
+func (m *Manager) Add(s *Session) error {
+	if s.StreamSid == "" {
+		return fmt.Errorf("session has no streamSid")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.sessions[s.StreamSid]; exists {
+		return fmt.Errorf("session %s already registered", s.StreamSid)
+	}
+	m.sessions[s.StreamSid] = s
+	log.Printf("Session %s started (call %s), %d live", s.StreamSid, s.CallSid, len(m.sessions))
+	return nil
+}
+
+// Get finds a live session by streamSid or callSid
+func (m *Manager) Get(id string) (*Session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if s, ok := m.sessions[id]; ok {
+		return s, true
+	}
+	for _, s := range m.sessions {
+		if s.CallSid != "" && s.CallSid == id {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the live sessions, oldest first
+func (m *Manager) List() []*Session {
+	m.mu.RLock()
+	list := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		list = append(list, s)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	return list
+}
+
+// Len returns the number of live sessions
+func (m *Manager) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions)
+}
+
+// Remove unregisters the session and tears it down
+func (m *Manager) Remove(streamSid string) {
+	m.mu.Lock()
+	s, ok := m.sessions[streamSid]
+	delete(m.sessions, streamSid)
+	remaining := len(m.sessions)
+	m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	s.Close()
+	log.Printf("Session %s removed after %s, %d live", streamSid, s.Duration(), remaining)
+}
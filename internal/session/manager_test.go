@@ -0,0 +1,35 @@
+package session
+
+import "testing"
+
+func TestManagerLookupAndRemove(t *testing.T) {
+	m := NewManager()
+	closed := false
+	s := New("MZ123", "CA456")
+	s.OnClose(func() { closed = true })
+
+	if err := m.Add(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add(New("MZ123", "CA789")); err == nil {
+		t.Fatal("duplicate streamSid accepted")
+	}
+
+	if got, ok := m.Get("MZ123"); !ok || got != s {
+		t.Fatal("session not found by streamSid")
+	}
+	if got, ok := m.Get("CA456"); !ok || got != s {
+		t.Fatal("session not found by callSid")
+	}
+	if len(m.List()) != 1 {
+		t.Fatalf("expected 1 live session, got %d", len(m.List()))
+	}
+
+	m.Remove("MZ123")
+	if !closed {
+		t.Fatal("session was not closed on remove")
+	}
+	if _, ok := m.Get("MZ123"); ok || m.Len() != 0 {
+		t.Fatal("session still registered after remove")
+	}
+}
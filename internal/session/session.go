@@ -0,0 +1,57 @@
+// Package session keeps track of live calls, one isolated session per Twilio media stream
+package session
+
+import (
+	"sync"
+	"time"
+	"twilio-go-stream/internal/core"
+)
+
+// Session owns everything that belongs to a single call: the core client with its
+// STT, TTS, interrupt detector and LLM history, plus the teardown of its providers
+type Session struct {
+	StreamSid string
+	CallSid   string
+	AgentID   string // profile answering the call
+	StartedAt time.Time
+	Core      *core.Client
+
+	mu        sync.Mutex
+	closers   []func()
+	closeOnce sync.Once
+}
+
+// New creates a session for the given media stream, Core is attached once providers are built
+func New(streamSid, callSid string) *Session {
+	return &Session{
+		StreamSid: streamSid,
+		CallSid:   callSid,
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+// OnClose registers a cleanup func, they run in reverse order when the session is closed
+func (s *Session) OnClose(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closers = append(s.closers, f)
+}
+
+// Close tears down the session providers, it is safe to call more than once
+func (s *Session) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		closers := s.closers
+		s.closers = nil
+		s.mu.Unlock()
+
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	})
+}
+
+// Duration returns how long the call has been live
+func (s *Session) Duration() time.Duration {
+	return time.Since(s.StartedAt)
+}
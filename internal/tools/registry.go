@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"twilio-go-stream/domain"
+)
+
+// emptySchema is used for tools that take no arguments
+var emptySchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// Handler runs a tool, args is the JSON object the LLM produced for the tool's schema.
+// The returned string is sent back to the LLM as the tool result.
+type Handler func(ctx context.Context, args json.RawMessage) (string, error)
+
+// Tool is a function the LLM can call during a conversation
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage // JSON schema of the arguments
+	Handler     Handler
+}
+
+// Registry holds the tools offered to the LLM
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+	order []string // tools are offered in registration order
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: map[string]Tool{}}
+}
+
+// Register adds a tool, names must be unique
+func (r *Registry) Register(tool Tool) error {
+	if tool.Name == "" || tool.Handler == nil {
+		return fmt.Errorf("tool needs a name and a handler")
+	}
+	if len(tool.Parameters) == 0 {
+		tool.Parameters = emptySchema
+	} else if !json.Valid(tool.Parameters) {
+		return fmt.Errorf("tool %s has an invalid parameters schema", tool.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[tool.Name]; ok {
+		return fmt.Errorf("tool %s already registered", tool.Name)
+	}
+	r.tools[tool.Name] = tool
+	r.order = append(r.order, tool.Name)
+	return nil
+}
+
+// Func registers a Go function as a tool
+func (r *Registry) Func(name, description string, parameters json.RawMessage, handler Handler) error {
+	return r.Register(Tool{Name: name, Description: description, Parameters: parameters, Handler: handler})
+}
+
+// Clone copies the registry so per-call tools can be added without touching the shared one
+func (r *Registry) Clone() *Registry {
+	clone := NewRegistry()
+	if r == nil {
+		return clone
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, name := range r.order {
+		clone.tools[name] = r.tools[name]
+	}
+	clone.order = append(clone.order, r.order...)
+	return clone
+}
+
+// Len returns the number of registered tools
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.order)
+}
+
+// Definitions returns the tools in the format sent to the LLM
+func (r *Registry) Definitions() []domain.Tool {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	definitions := make([]domain.Tool, 0, len(r.order))
+	for _, name := range r.order {
+		tool := r.tools[name]
+		definitions = append(definitions, domain.Tool{
+			Type: "function",
+			Function: domain.ToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return definitions
+}
+
+// Call runs the tool the LLM asked for. Failures are reported as the result so the
+// LLM can tell the caller instead of the conversation stopping.
+func (r *Registry) Call(ctx context.Context, call domain.ToolCall) string {
+	start := time.Now().UTC()
+	var tool Tool
+	var ok bool
+	if r != nil {
+		r.mu.RLock()
+		tool, ok = r.tools[call.Function.Name]
+		r.mu.RUnlock()
+	}
+	if !ok {
+		log.Printf("LLM called unknown tool %q", call.Function.Name)
+		return fmt.Sprintf("error: unknown tool %s", call.Function.Name)
+	}
+
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return fmt.Sprintf("error: arguments for %s are not valid JSON", call.Function.Name)
+	}
+
+	result, err := tool.Handler(ctx, args)
+	log.Printf("Tool %s took %v", call.Function.Name, time.Now().UTC().Sub(start))
+	if err != nil {
+		log.Printf("Tool %s failed: %v", call.Function.Name, err)
+		return "error: " + err.Error()
+	}
+	return result
+}
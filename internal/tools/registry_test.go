@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"twilio-go-stream/domain"
+)
+
+func call(name, args string) domain.ToolCall {
+	return domain.ToolCall{ID: "call_1", Type: "function", Function: domain.FunctionCall{Name: name, Arguments: args}}
+}
+
+func TestRegistryFunc(t *testing.T) {
+	r := NewRegistry()
+	err := r.Func("echo", "Echo the text", json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}}}`),
+		func(ctx context.Context, args json.RawMessage) (string, error) {
+			var params struct{ Text string }
+			if err := json.Unmarshal(args, &params); err != nil {
+				return "", err
+			}
+			return params.Text, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Func("echo", "", nil, func(context.Context, json.RawMessage) (string, error) { return "", nil }); err == nil {
+		t.Fatal("duplicate tool accepted")
+	}
+
+	definitions := r.Definitions()
+	if len(definitions) != 1 || definitions[0].Function.Name != "echo" || definitions[0].Type != "function" {
+		t.Fatalf("unexpected definitions %+v", definitions)
+	}
+
+	if got := r.Call(context.Background(), call("echo", `{"text":"hi"}`)); got != "hi" {
+		t.Fatalf("echo returned %q", got)
+	}
+	if got := r.Call(context.Background(), call("missing", `{}`)); !strings.HasPrefix(got, "error:") {
+		t.Fatalf("unknown tool returned %q", got)
+	}
+	if got := r.Call(context.Background(), call("echo", `{"text":`)); !strings.HasPrefix(got, "error:") {
+		t.Fatalf("invalid arguments returned %q", got)
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	shared := NewRegistry()
+	noop := func(context.Context, json.RawMessage) (string, error) { return "", nil }
+	shared.Func("a", "", nil, noop)
+
+	perCall := shared.Clone()
+	if err := perCall.Func("b", "", nil, noop); err != nil {
+		t.Fatal(err)
+	}
+	if shared.Len() != 1 || perCall.Len() != 2 {
+		t.Fatalf("clone shares tools: %d, %d", shared.Len(), perCall.Len())
+	}
+
+	var none *Registry
+	if none.Clone().Len() != 0 {
+		t.Fatal("nil registry clone not empty")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Tool      string          `json:"tool"`
+			Arguments json.RawMessage `json:"arguments"`
+			Call      Call            `json:"call"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if body.Tool != "check_order" || string(body.Arguments) != `{"order_id":"42"}` || body.Call.CallSid != "CA1" {
+			t.Errorf("unexpected webhook body %+v", body)
+		}
+		w.Write([]byte(`{"status":"shipped"}`))
+	}))
+	defer server.Close()
+
+	r := NewRegistry()
+	r.Register(Webhook(WebhookConfig{Name: "check_order", URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}))
+	r.Register(Webhook(WebhookConfig{Name: "unauthorized", URL: server.URL}))
+
+	ctx := WithCall(context.Background(), Call{CallSid: "CA1", StreamSid: "MZ1"})
+	if got := r.Call(ctx, call("check_order", `{"order_id":"42"}`)); got != `{"status":"shipped"}` {
+		t.Fatalf("webhook returned %q", got)
+	}
+	if got := r.Call(ctx, call("unauthorized", `{}`)); !strings.Contains(got, "401") {
+		t.Fatalf("failing webhook returned %q", got)
+	}
+}
+
+func TestLoadWebhooksRejectsReservedNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.json")
+	if err := os.WriteFile(path, []byte(`[{"name":"hang_up","url":"http://localhost/hang-up"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRegistry().LoadWebhooks(path, "hang_up"); err == nil {
+		t.Fatal("reserved tool name accepted")
+	}
+	if err := NewRegistry().LoadWebhooks(path); err != nil {
+		t.Fatal(err)
+	}
+}
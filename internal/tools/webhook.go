@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds how long the caller waits in silence for a webhook
+const webhookTimeout = 10 * time.Second
+
+// Call identifies the phone call a tool runs for
+type Call struct {
+	CallSid   string `json:"call_sid"`
+	StreamSid string `json:"stream_sid"`
+	AgentID   string `json:"agent_id,omitempty"`
+}
+
+type callKey struct{}
+
+// WithCall attaches the call to ctx so tool handlers know which call they act on
+func WithCall(ctx context.Context, call Call) context.Context {
+	return context.WithValue(ctx, callKey{}, call)
+}
+
+// CallFrom returns the call attached by WithCall
+func CallFrom(ctx context.Context) (Call, bool) {
+	call, ok := ctx.Value(callKey{}).(Call)
+	return call, ok
+}
+
+// WebhookConfig describes a tool implemented by an HTTP endpoint
+type WebhookConfig struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Parameters  json.RawMessage   `json:"parameters"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// Webhook builds a tool that POSTs {"tool", "arguments", "call"} to the URL,
+// the response body is the result given to the LLM
+func Webhook(cfg WebhookConfig) Tool {
+	client := &http.Client{Timeout: webhookTimeout}
+	return Tool{
+		Name:        cfg.Name,
+		Description: cfg.Description,
+		Parameters:  cfg.Parameters,
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			call, _ := CallFrom(ctx)
+			body, err := json.Marshal(struct {
+				Tool      string          `json:"tool"`
+				Arguments json.RawMessage `json:"arguments"`
+				Call      Call            `json:"call"`
+			}{cfg.Name, args, call})
+			if err != nil {
+				return "", err
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+			if err != nil {
+				return "", err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range cfg.Headers {
+				req.Header.Set(k, v)
+			}
+
+			res, err := client.Do(req)
+			if err != nil {
+				return "", err
+			}
+			defer res.Body.Close()
+			result, err := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+			if err != nil {
+				return "", err
+			}
+			if res.StatusCode >= 300 {
+				return "", fmt.Errorf("webhook returned %s: %s", res.Status, strings.TrimSpace(string(result)))
+			}
+			return string(result), nil
+		},
+	}
+}
+
+// LoadWebhooks registers the webhook tools listed in a JSON file, none of them may use a reserved name
+func (r *Registry) LoadWebhooks(path string, reserved ...string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var configs []WebhookConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for _, cfg := range configs {
+		if cfg.URL == "" {
+			return fmt.Errorf("tool %s has no url", cfg.Name)
+		}
+		if slices.Contains(reserved, cfg.Name) {
+			return fmt.Errorf("tool %s is reserved for a built-in tool", cfg.Name)
+		}
+		if err := r.Register(Webhook(cfg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
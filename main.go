@@ -1,10 +1,17 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"twilio-go-stream/handler"
+	"twilio-go-stream/internal/agent"
+	"twilio-go-stream/internal/config"
+	"twilio-go-stream/internal/core"
+	"twilio-go-stream/internal/provider"
+	"twilio-go-stream/internal/tools"
+	"twilio-go-stream/sdk/twilio"
 
 	"github.com/joho/godotenv"
 )
@@ -18,34 +25,91 @@ func loadEnv() {
 	}
 }
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	return value
-}
-
 func main() {
 	// Load environment variables
 	loadEnv()
 
-	// Get configuration from environment variables
-	publicURL := getEnv("PUBLIC_URL", "twilio-go-stream-804663264218.us-central1.run.app")
-	sttProvider := getEnv("STT_PROVIDER", "deepgram")
-	ttsProvider := getEnv("TTS_PROVIDER", "deepgram")
+	// Settings come from CONFIG_FILE (or -config), then the environment, then flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if cfg != nil {
+		// the configured providers must be registered and have their credentials
+		err = errors.Join(err, provider.Check(cfg))
+	}
+	if len(args) > 0 && args[0] == "providers" {
+		// list the registered providers and the settings they read
+		if cfg == nil {
+			log.Fatal(err)
+		}
+		if descErr := provider.Describe(os.Stdout, cfg); descErr != nil {
+			log.Fatal(descErr)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "dump" {
+		// print the effective configuration, secrets redacted
+		if cfg == nil {
+			log.Fatal(err)
+		}
+		if dumpErr := cfg.Dump(os.Stdout); dumpErr != nil {
+			log.Fatal(dumpErr)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Log the providers being used
-	log.Printf("Using STT provider: %s", sttProvider)
-	log.Printf("Using TTS provider: %s", ttsProvider)
+	log.Printf("Available providers: STT %v, TTS %v, LLM %v", provider.STTProviders(), provider.TTSProviders(), provider.LLMProviders())
+	log.Printf("Using STT provider: %s", cfg.STT.Provider)
+	log.Printf("Using TTS provider: %s", cfg.TTS.Provider)
+
+	// Twilio auth token is used to verify X-Twilio-Signature on every request
+	twilioClient := twilio.Must(
+		cfg.Twilio.APIURL,
+		"https://"+cfg.Server.PublicURL+"/incoming-call",
+		cfg.Twilio.AuthToken,
+		"mulaw",
+		"",
+		8000,
+	)
+	twilioClient.AccountSid = cfg.Twilio.AccountSid
+
+	// LLM backend is selected by llm.provider (groq, openai or openai-compatible)
+	llm, err := provider.NewLLM(cfg.LLM.Provider, cfg)
+	if err != nil {
+		log.Fatalf("Invalid LLM configuration: %v", err)
+	}
+	log.Printf("Using LLM provider: %s", cfg.LLM.Provider)
 
 	// Initialize handler
-	handlers := handler.New(publicURL, sttProvider, ttsProvider)
+	handlers := handler.New(cfg, twilioClient, llm)
+
+	// Webhook tools the LLM may call, hang_up and transfer_call are always available
+	registry := tools.NewRegistry()
+	if cfg.ToolsFile != "" {
+		if err := registry.LoadWebhooks(cfg.ToolsFile, core.BuiltinTools...); err != nil {
+			log.Fatalf("Loading tools from %s: %v", cfg.ToolsFile, err)
+		}
+		log.Printf("Loaded %d tools from %s", registry.Len(), cfg.ToolsFile)
+	}
+	handlers.UseTools(registry)
+
+	// Agent profiles pick the prompt, voice, tools and transfer target of each call
+	if cfg.AgentsPath != "" {
+		agents, err := agent.Load(cfg.AgentsPath)
+		if err != nil {
+			log.Fatalf("Loading agents from %s: %v", cfg.AgentsPath, err)
+		}
+		log.Printf("Loaded %d agents from %s", len(agents.Profiles()), cfg.AgentsPath)
+		handlers.UseAgents(agents)
+	}
 	handlers.SetRoutes()
 
 	// Start HTTP server
-	port := getEnv("PORT", "8080")
-	log.Printf("Server started on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Printf("Server started on port %d", cfg.Server.Port)
+	log.Fatal(http.ListenAndServe(cfg.Addr(), nil))
 }
@@ -3,6 +3,7 @@ package dectector
 import (
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -11,7 +12,15 @@ var COOLING_PERIOD_INTRRUPT = 10 * time.Second
 var COOLING_PERIOD_NO_ONE_SPOKE = 15 * time.Second
 var NO_ONE_SPOKE_IN_LAST_X_SEC = 15 * time.Second
 
+var MAX_CALL_DURATION = 280 * time.Second
+
+// pollInterval is how often the managers check the state of the call
+const pollInterval = 100 * time.Millisecond
+
+// Interrupt tracks who is speaking. The state is updated from the media stream, playback and
+// manager goroutines, mu guards it; the settings and callbacks are set before Manager is called.
 type Interrupt struct {
+	mu                         sync.Mutex
 	AgentSpeaking              bool
 	UserSpeaking               bool
 	LastEventFiredAt           time.Time
@@ -19,40 +28,91 @@ type Interrupt struct {
 	LastTimeAgentSpoke         time.Time
 	LastTimeUserSpoke          time.Time
 	callStartedAt              time.Time
+	silencePaused              bool // the caller is typing on the keypad, silence is expected
 	CallDuration               int
 	AgentResponse              func(bool, string)
+	OnBargeIn                  func()        // stops the agent when the user talks over it
+	OnMaxDuration              func()        // ends the call once it reaches MaxCallDuration
+	MaxCallDuration            time.Duration // MAX_CALL_DURATION when zero
+	SilenceTimeout             time.Duration // NO_ONE_SPOKE_IN_LAST_X_SEC when zero
+	InterruptCooldown          time.Duration // COOLING_PERIOD_INTRRUPT when zero
+	RepromptCooldown           time.Duration // COOLING_PERIOD_NO_ONE_SPOKE when zero
 }
 
 func (i *Interrupt) AgentSpoke(b bool) { //attach to AgentResponse where audio is pused to ws
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.AgentSpeaking = b
 
 	i.LastTimeAgentSpoke = time.Now()
 
 }
 func (i *Interrupt) UserSpoke(b bool) { //attach to interim result
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.UserSpeaking = b
 
 	i.LastTimeUserSpoke = time.Now()
 
 }
 
+// UserActivity records that the user did something other than talking, e.g. pressed a key,
+// so the "are you still there?" reprompt is held back
+func (i *Interrupt) UserActivity() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.LastTimeUserSpoke = time.Now()
+}
+
+// PauseSilence holds the "are you still there?" reprompt back while paused, e.g. during a keypad entry
+func (i *Interrupt) PauseSilence(paused bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.silencePaused = paused
+	i.LastTimeUserSpoke = time.Now()
+}
+
 func (i *Interrupt) Reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.AgentSpeaking = false
 	i.UserSpeaking = false
 	// i.LastEventFiredAt = time.Now()
 }
 func (i *Interrupt) IsInterrupt() bool {
-	return i.AgentSpeaking && i.UserSpeaking && !i.IsCooling()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.AgentSpeaking && i.UserSpeaking && !i.isCooling()
 }
 
 func (i *Interrupt) IsCooling() bool { //returns false is system is cool again
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.isCooling()
+}
+
+func (i *Interrupt) isCooling() bool {
 	// coolling should be based on when user completes speaking right
 	// it should be not cool till AgentResponse is called for LLM response only, once it is called system should be cool
-	return time.Since(i.LastEventFiredAt) < COOLING_PERIOD_INTRRUPT
+	cooldown := COOLING_PERIOD_INTRRUPT
+	if i.InterruptCooldown > 0 {
+		cooldown = i.InterruptCooldown
+	}
+	return time.Since(i.LastEventFiredAt) < cooldown
 }
 
 func (i *Interrupt) NoOneSpokeCooling() bool {
-	return time.Since(i.LastNoOneSpokeEventFiredAt) < COOLING_PERIOD_NO_ONE_SPOKE
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.noOneSpokeCooling()
+}
+
+func (i *Interrupt) noOneSpokeCooling() bool {
+	cooldown := COOLING_PERIOD_NO_ONE_SPOKE
+	if i.RepromptCooldown > 0 {
+		cooldown = i.RepromptCooldown
+	}
+	return time.Since(i.LastNoOneSpokeEventFiredAt) < cooldown
 }
 
 // GenerateRandomNumber returns a random number between min and max (inclusive)
@@ -60,37 +120,35 @@ func GenerateRandomNumber(min, max int) int {
 	rand.Seed(time.Now().UnixNano()) // Seed to ensure randomness
 	return rand.Intn(max-min+1) + min
 }
+
+// FireInterrupt handles the caller talking over the agent, playback is stopped through OnBargeIn
 func (i *Interrupt) FireInterrupt() {
-	if i.IsCooling() {
+	i.mu.Lock()
+	if i.isCooling() {
+		i.mu.Unlock()
 		return
 	}
-	go func() {
-
-		// min, max := 0, 5 // Define range
-		// fillerWords := []string{
-		// 	// English Filler Words
-		// 	"alright", "okay", "umm", "uh", "hmm", "you know", "like", "I mean", "well",
-		// 	"actually", "so", "kind of", "sort of", "basically", "I guess", "let’s see",
-		// 	"you see", "I suppose", "by the way", "right",
-
-		// 	// Hindi Filler Words
-		// 	"अच्छा", "हाँ", "मतलब", "जैसे", "वैसे", "उम", "हूँ", "तो", "देखो", "समझे",
-		// 	"चलो", "बात ये है कि", "सही है", "वो क्या कहते हैं", "मेरा मतलब है", "थोड़ा सा",
-		// 	"कुछ ऐसा",
-		// }
-		// max = len(fillerWords) - 1
-		// randomNumber := GenerateRandomNumber(min, max)
-
-		i.AgentResponse(false, "yes")
-	}()
+	i.LastEventFiredAt = time.Now()
+	i.mu.Unlock()
+	if i.OnBargeIn != nil {
+		go i.OnBargeIn()
+	}
 
 	fmt.Println("Interrupt Fired -----------------------------------------------------------")
-	i.LastEventFiredAt = time.Now()
 }
 
 func (i *Interrupt) DidNoOneSpokeInLastXSec() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.silencePaused {
+		return false
+	}
 
-	if time.Since(i.LastTimeAgentSpoke) > NO_ONE_SPOKE_IN_LAST_X_SEC && time.Since(i.LastTimeUserSpoke) > NO_ONE_SPOKE_IN_LAST_X_SEC {
+	silence := NO_ONE_SPOKE_IN_LAST_X_SEC
+	if i.SilenceTimeout > 0 {
+		silence = i.SilenceTimeout
+	}
+	if time.Since(i.LastTimeAgentSpoke) > silence && time.Since(i.LastTimeUserSpoke) > silence {
 		// i.AgentResponse(false, "How can I help you?")
 		return !i.AgentSpeaking && !i.UserSpeaking
 	}
@@ -98,30 +156,42 @@ func (i *Interrupt) DidNoOneSpokeInLastXSec() bool {
 }
 
 func (i *Interrupt) FireNoOneSpokeInLastXSec() {
-	if i.NoOneSpokeCooling() {
+	i.mu.Lock()
+	if i.noOneSpokeCooling() {
+		i.mu.Unlock()
 		return
 	}
+	i.LastNoOneSpokeEventFiredAt = time.Now()
+	i.mu.Unlock()
 	go func() {
 		time.Sleep(1 * time.Second)
 		i.AgentResponse(false, "are you still there?")
 	}()
 
 	fmt.Println("No one spoke Fired -----------------------------------------------------------")
-	i.LastNoOneSpokeEventFiredAt = time.Now()
 }
 
-func (i *Interrupt) InterruptsManager() {
-	go func() {
-		for {
-			if i.IsInterrupt() {
-				i.FireInterrupt()
-			}
-			if i.DidNoOneSpokeInLastXSec() {
-				i.FireNoOneSpokeInLastXSec()
-			}
-			time.Sleep(100 * time.Millisecond)
+// InterruptsManager watches for the caller talking over the agent until stopChan is closed
+func (i *Interrupt) InterruptsManager(stopChan <-chan struct{}) {
+	go i.poll(stopChan, func() {
+		if i.IsInterrupt() {
+			i.FireInterrupt()
 		}
-	}()
+	})
+}
+
+// poll runs check every pollInterval until stopChan is closed
+func (i *Interrupt) poll(stopChan <-chan struct{}, check func()) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
 }
 
 func (i *Interrupt) Manager(stopChan chan struct{}) {
@@ -130,40 +200,52 @@ func (i *Interrupt) Manager(stopChan chan struct{}) {
 	// InterruptManager(stopChan)
 	// close(stopChan)
 
+	i.mu.Lock()
 	i.callStartedAt = time.Now()
+	i.mu.Unlock()
 	i.CallDurationManager(stopChan)
-	i.InterruptsManager()
-	i.NoOneSpokeManager()
+	i.InterruptsManager(stopChan)
+	i.NoOneSpokeManager(stopChan)
 
 }
 
-func (i *Interrupt) NoOneSpokeManager() {
-	go func() {
-		for {
-
-			if i.DidNoOneSpokeInLastXSec() {
-				i.FireNoOneSpokeInLastXSec()
-			}
-			fmt.Println("Duration: ", i.CallDuration)
-			time.Sleep(100 * time.Millisecond)
+// NoOneSpokeManager reprompts the caller after a silence until stopChan is closed
+func (i *Interrupt) NoOneSpokeManager(stopChan <-chan struct{}) {
+	go i.poll(stopChan, func() {
+		if i.DidNoOneSpokeInLastXSec() {
+			i.FireNoOneSpokeInLastXSec()
 		}
-	}()
+	})
 }
 
-func (i *Interrupt) CallDurationManager(stopChan chan struct{}) {
+func (i *Interrupt) CallDurationManager(stopChan <-chan struct{}) {
+	maxDuration := MAX_CALL_DURATION
+	if i.MaxCallDuration > 0 {
+		maxDuration = i.MaxCallDuration
+	}
+	i.mu.Lock()
+	startedAt := i.callStartedAt
+	i.mu.Unlock()
 	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-stopChan:
 				return
-			default:
-				i.CallDuration = int(time.Since(i.callStartedAt).Seconds())
-				if i.CallDuration > 280 {
+			case <-ticker.C:
+			}
+			i.mu.Lock()
+			i.CallDuration = int(time.Since(startedAt).Seconds())
+			i.mu.Unlock()
+			if time.Since(startedAt) > maxDuration {
+				if i.OnMaxDuration != nil {
+					i.OnMaxDuration()
+				} else {
 					i.AgentResponse(false, "Thank you for calling, Goodbye")
-					return
 				}
+				return
 			}
-			time.Sleep(100 * time.Millisecond)
 		}
 	}()
 }
@@ -12,7 +12,9 @@ func TestInterruptDetection(t *testing.T) {
 	var wg sync.WaitGroup
 
 	// Start the interrupt manager in a separate goroutine
-	interrupt.InterruptsManager()
+	stop := make(chan struct{})
+	defer close(stop)
+	interrupt.InterruptsManager(stop)
 
 	// Simulate agent speaking first
 	wg.Add(1)
@@ -51,7 +53,9 @@ func TestUserStartsBeforeAgent(t *testing.T) {
 
 	var wg sync.WaitGroup
 
-	interrupt.InterruptsManager()
+	stop := make(chan struct{})
+	defer close(stop)
+	interrupt.InterruptsManager(stop)
 
 	// User starts speaking first
 	wg.Add(1)
@@ -83,7 +87,9 @@ func TestAgentAndUserStartTogether(t *testing.T) {
 
 	var wg sync.WaitGroup
 
-	interrupt.InterruptsManager()
+	stop := make(chan struct{})
+	defer close(stop)
+	interrupt.InterruptsManager(stop)
 
 	wg.Add(2)
 	go func() {
@@ -111,7 +117,9 @@ func TestUserInterruptsMultipleTimes(t *testing.T) {
 
 	var wg sync.WaitGroup
 
-	interrupt.InterruptsManager()
+	stop := make(chan struct{})
+	defer close(stop)
+	interrupt.InterruptsManager(stop)
 
 	wg.Add(2)
 	go func() {
@@ -143,7 +151,9 @@ func TestAlternatingSpeechNoInterrupt(t *testing.T) {
 
 	var wg sync.WaitGroup
 
-	interrupt.InterruptsManager()
+	stop := make(chan struct{})
+	defer close(stop)
+	interrupt.InterruptsManager(stop)
 
 	wg.Add(2)
 	go func() {
@@ -178,7 +188,9 @@ func TestAgentStopsBeforeUserStarts(t *testing.T) {
 
 	var wg sync.WaitGroup
 
-	interrupt.InterruptsManager()
+	stop := make(chan struct{})
+	defer close(stop)
+	interrupt.InterruptsManager(stop)
 
 	wg.Add(2)
 	go func() {
@@ -8,132 +8,260 @@ package deepgram
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"twilio-go-stream/domain"
 
 	api "github.com/deepgram/deepgram-go-sdk/pkg/api/listen/v1/websocket/interfaces"
 	interfaces "github.com/deepgram/deepgram-go-sdk/pkg/client/interfaces"
 	client "github.com/deepgram/deepgram-go-sdk/pkg/client/listen"
 	websocketv1 "github.com/deepgram/deepgram-go-sdk/pkg/client/listen/v1/websocket"
-	"github.com/gorilla/websocket"
 )
 
-const secondToConsiderSpeechEnd = 2
-
-type UserSaid struct {
-	text          string
-	when          time.Time
-	said          bool
-	isFinal       bool
-	mu            sync.Mutex
-	sb            *strings.Builder
-	AgentResponse func(bool, string)
-	UserSpeaking  func(bool)
-}
-
-func (u *UserSaid) Say(text string, isFinal bool) {
-	u.mu.Lock()
-	defer u.mu.Unlock()
-	u.text = text
-	u.said = true
-	u.isFinal = isFinal
-	u.when = time.Now().UTC()
-}
-func (u *UserSaid) MonitorAndTrigger() {
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-	largeSentence := ""
-	// pastSaid := ""
-	for {
+// eventBuffer holds transcript events until the call reads them
+const eventBuffer = 64
+
+// Reconnects after a dropped connection wait reconnectDelay, doubled after every failed attempt
+const (
+	reconnectAttempts = 5
+	reconnectDelay    = 250 * time.Millisecond
+	// maxGapAudio is 10s of 8kHz μ-law, older audio received while reconnecting is dropped
+	maxGapAudio = 80000
+)
+
+// DeepgramSTTCallback streams caller audio to Deepgram live transcription and turns its
+// responses into transcript events. A dropped connection is reopened with exponential backoff,
+// the audio received meanwhile is sent once it is back.
+type DeepgramSTTCallback struct {
+	newClient func(ctx context.Context, callback api.LiveMessageCallback) (*websocketv1.WSCallback, error)
+	ctx       context.Context
+
+	mu           sync.Mutex
+	dgClient     *websocketv1.WSCallback
+	generation   int  // bumped for every connection, callbacks of older ones are ignored
+	connected    bool // false while reconnecting
+	reconnecting bool
+	gap          []byte // audio received while disconnected
+
+	events    chan domain.TranscriptEvent
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// sttConnection tells the callbacks of one Deepgram connection apart from the next one
+type sttConnection struct {
+	*DeepgramSTTCallback
+	generation int
+}
+
+// Close is called by the SDK when the connection ends, including when it drops
+func (c *sttConnection) Close(ocr *api.CloseResponse) error {
+	fmt.Printf("\n[Close] Received\n")
+	// the SDK holds its connection lock here, reconnecting must happen elsewhere
+	go c.dropped(c.generation)
+	return nil
+}
+
+// Start connects to Deepgram, events are delivered until ctx is done or Stop is called
+func (c *DeepgramSTTCallback) Start(ctx context.Context) error {
+	if c.newClient == nil {
+		return fmt.Errorf("deepgram STT client is not initialized")
+	}
+	c.ctx = ctx
+	if err := c.connect(); err != nil {
+		return err
+	}
+	go func() {
 		select {
-		// case ctx.CancelFunc://add this later
-		// 	fmt.Println("Closing routine MonitorAndTrigger")
-		// 	return
-		case <-ticker.C:
-			u.mu.Lock()
-			if u.isFinal {
-				largeSentence += ". " + u.text
-				u.isFinal = false
-			}
-			// if pastSaid = u.said{
-			// 	u.said=false
-			// }
-			if time.Since(u.when) > secondToConsiderSpeechEnd*time.Second && u.said {
-				largeSentence += "" + u.text
-				u.said = false
-				if u.sb != nil {
-					u.sb.Reset()
-					// fmt.Println("Clearned")
-				}
-				u.UserSpeaking(false)
-				u.AgentResponse(true, largeSentence)
-				fmt.Println("Triggggggggger broo mateyyyys", time.Now().UTC())
-				fmt.Println("--------------------------------------------", largeSentence)
-				largeSentence = ""
-			}
-			u.mu.Unlock()
+		case <-ctx.Done():
+			c.Stop()
+		case <-c.done:
 		}
+	}()
+	return nil
+}
+
+// connect opens a new connection and replays the audio of the gap before any new audio
+func (c *DeepgramSTTCallback) connect() error {
+	c.mu.Lock()
+	c.generation++
+	generation := c.generation
+	c.mu.Unlock()
+
+	dgClient, err := c.newClient(c.ctx, &sttConnection{DeepgramSTTCallback: c, generation: generation})
+	if err != nil {
+		return fmt.Errorf("creating Deepgram STT client: %w", err)
 	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	// a single attempt, retries are done here with backoff instead of the SDK's fixed delay
+	if !dgClient.ConnectWithCancel(ctx, cancel, 1) {
+		cancel()
+		return fmt.Errorf("connecting to Deepgram STT failed")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		go dgClient.Stop()
+		return fmt.Errorf("deepgram STT client stopped")
+	default:
+	}
+	c.dgClient = dgClient
+	c.connected = true
+	if len(c.gap) > 0 {
+		log.Printf("Replaying %dms of audio received while reconnecting", len(c.gap)/8)
+		if _, err := dgClient.Write(c.gap); err != nil {
+			log.Println("Error replaying audio to Deepgram:", err)
+		}
+		c.gap = nil
+	}
+	return nil
 }
 
-// Implement your own callback
-type DeepgramSTTCallback struct {
-	sb       *strings.Builder
-	dgClient *websocketv1.WSCallback
-	Sid      string
-	WsConn   *websocket.Conn
-	UserSaid *UserSaid
+// dropped reconnects unless the connection was stopped or already replaced
+func (c *DeepgramSTTCallback) dropped(generation int) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	c.mu.Lock()
+	if generation != c.generation || c.reconnecting {
+		c.mu.Unlock()
+		return
+	}
+	c.connected = false
+	c.reconnecting = true
+	old := c.dgClient
+	c.mu.Unlock()
+
+	log.Println("Deepgram STT connection dropped, reconnecting")
+	// stopping keeps the SDK from reconnecting the old client on its own
+	go old.Stop()
+	c.reconnect()
 }
 
-func (c DeepgramSTTCallback) ConnectWS() {
-	bConnected := c.dgClient.Connect()
-	if !bConnected {
-		fmt.Println("Client.Connect failed")
-		os.Exit(1)
+func (c *DeepgramSTTCallback) reconnect() {
+	delay := reconnectDelay
+	for attempt := 1; attempt <= reconnectAttempts; attempt++ {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(delay):
+		}
+		err := c.connect()
+		if err == nil {
+			log.Printf("Deepgram STT reconnected after %d attempts", attempt)
+			c.mu.Lock()
+			c.reconnecting = false
+			c.mu.Unlock()
+			return
+		}
+		log.Printf("Deepgram STT reconnect attempt %d failed: %v", attempt, err)
+		delay *= 2
 	}
+	log.Printf("Giving up on Deepgram STT after %d attempts", reconnectAttempts)
+	c.emit(domain.TranscriptEvent{Type: domain.TranscriptFailed})
 }
-func (c DeepgramSTTCallback) Disconnect() {
-	// close DG client
-	defer c.dgClient.Stop()
+
+// Write sends μ-law audio as received from Twilio, while reconnecting it is kept for later
+func (c *DeepgramSTTCallback) Write(audio []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		c.gap = append(c.gap, audio...)
+		if len(c.gap) > maxGapAudio {
+			c.gap = c.gap[len(c.gap)-maxGapAudio:]
+		}
+		return nil
+	}
+	_, err := c.dgClient.Write(audio)
+	return err
 }
 
-func (c DeepgramSTTCallback) Message(mr *api.MessageResponse) error {
-	// handle the message
-	sentence := strings.TrimSpace(mr.Channel.Alternatives[0].Transcript)
+// Events returns the transcript events, the channel is never closed
+func (c *DeepgramSTTCallback) Events() <-chan domain.TranscriptEvent {
+	return c.events
+}
 
-	if len(mr.Channel.Alternatives) == 0 || len(sentence) == 0 {
-		return nil
+// Stop closes the Deepgram connection, it is safe to call more than once
+func (c *DeepgramSTTCallback) Stop() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		dgClient := c.dgClient
+		c.connected = false
+		c.mu.Unlock()
+		if dgClient != nil {
+			dgClient.Stop()
+		}
+	})
+}
+
+// ConnectWS connects without a way to stop it with a context.
+// Deprecated: use Start.
+func (c *DeepgramSTTCallback) ConnectWS() error {
+	if c.ctx == nil {
+		c.ctx = context.Background()
 	}
+	return c.connect()
+}
 
-	if mr.IsFinal {
-		c.sb.WriteString(sentence)
-		c.sb.WriteString(" ")
+// Disconnect is Stop, kept for older callers
+func (c *DeepgramSTTCallback) Disconnect() {
+	c.Stop()
+}
 
-		if mr.SpeechFinal {
-			c.UserSaid.Say(c.sb.String(), true)
+// emit delivers an event unless the client was stopped meanwhile
+func (c *DeepgramSTTCallback) emit(ev domain.TranscriptEvent) {
+	ev.ReceivedAt = time.Now().UTC()
+	select {
+	case c.events <- ev:
+	case <-c.done:
+	}
+}
 
-			// c.AgentResponse(true, c.WsConn, c.sb.String(), c.Sid)
-			fmt.Printf("[------- Is Final]: %s %s\n", time.Now().UTC(), c.sb.String())
-			c.sb.Reset()
-		}
-	} else {
-		c.UserSaid.Say(c.sb.String(), false)
-		c.UserSaid.UserSpeaking(true)
-		fmt.Printf("[Interm Result]: %s %s\n", time.Now().UTC(), sentence)
+// seconds converts Deepgram's stream offsets
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func (c *DeepgramSTTCallback) Message(mr *api.MessageResponse) error {
+	if len(mr.Channel.Alternatives) == 0 {
+		return nil
+	}
+	alternative := mr.Channel.Alternatives[0]
+	sentence := strings.TrimSpace(alternative.Transcript)
+	if len(sentence) == 0 {
+		return nil
 	}
 
+	ev := domain.TranscriptEvent{
+		Type:       domain.TranscriptPartial,
+		Text:       sentence,
+		Confidence: alternative.Confidence,
+		Start:      seconds(mr.Start),
+		End:        seconds(mr.Start + mr.Duration),
+	}
+	if mr.IsFinal {
+		ev.Type = domain.TranscriptFinal
+	}
+	c.emit(ev)
 	return nil
 }
 
-func (c DeepgramSTTCallback) Open(ocr *api.OpenResponse) error {
+func (c *DeepgramSTTCallback) Open(ocr *api.OpenResponse) error {
 	// handle the open
 	fmt.Printf("\n[Open] Received\n")
 	return nil
 }
 
-func (c DeepgramSTTCallback) Metadata(md *api.MetadataResponse) error {
+func (c *DeepgramSTTCallback) Metadata(md *api.MetadataResponse) error {
 	// handle the metadata
 	fmt.Printf("\n[Metadata] Received\n")
 	fmt.Printf("Metadata.RequestID: %s\n", strings.TrimSpace(md.RequestID))
@@ -142,32 +270,22 @@ func (c DeepgramSTTCallback) Metadata(md *api.MetadataResponse) error {
 	return nil
 }
 
-func (c DeepgramSTTCallback) SpeechStarted(ssr *api.SpeechStartedResponse) error {
-	// fmt.Printf("\n[SpeechStarted] Received %s\n", time.Now().UTC())
+func (c *DeepgramSTTCallback) SpeechStarted(ssr *api.SpeechStartedResponse) error {
+	c.emit(domain.TranscriptEvent{Type: domain.SpeechStarted, Start: seconds(ssr.Timestamp), End: seconds(ssr.Timestamp)})
 	return nil
 }
 
-func (c DeepgramSTTCallback) UtteranceEnd(ur *api.UtteranceEndResponse) error {
-	utterance := strings.TrimSpace(c.sb.String())
-	if len(utterance) > 0 {
-		c.UserSaid.Say(c.sb.String(), true)
-		// c.AgentResponse(true, c.WsConn, c.sb.String(), c.Sid)
-		fmt.Printf("[------- UtteranceEnd]: %s\n %s", time.Now().UTC(), utterance)
-		c.sb.Reset()
-	} else {
-		fmt.Printf("\n[UtteranceEnd] Received %s\n", time.Now().UTC())
-	}
-
+func (c *DeepgramSTTCallback) UtteranceEnd(ur *api.UtteranceEndResponse) error {
+	c.emit(domain.TranscriptEvent{Type: domain.UtteranceEnd, Start: seconds(ur.LastWordEnd), End: seconds(ur.LastWordEnd)})
 	return nil
 }
 
-func (c DeepgramSTTCallback) Close(ocr *api.CloseResponse) error {
-	// handle the close
-	fmt.Printf("\n[Close] Received\n")
+func (c *DeepgramSTTCallback) Close(ocr *api.CloseResponse) error {
+	// connections are opened with sttConnection, which handles the close
 	return nil
 }
 
-func (c DeepgramSTTCallback) Error(er *api.ErrorResponse) error {
+func (c *DeepgramSTTCallback) Error(er *api.ErrorResponse) error {
 	// handle the error
 	fmt.Printf("\n[Error] Received\n")
 	fmt.Printf("Error.Type: %s\n", er.Type)
@@ -176,18 +294,68 @@ func (c DeepgramSTTCallback) Error(er *api.ErrorResponse) error {
 	return nil
 }
 
-func (c DeepgramSTTCallback) UnhandledEvent(byData []byte) error {
+func (c *DeepgramSTTCallback) UnhandledEvent(byData []byte) error {
 	// handle the unhandled event
 	fmt.Printf("\n[UnhandledEvent] Received\n")
 	fmt.Printf("UnhandledEvent: %s\n\n", string(byData))
 	return nil
 }
 
-func (c DeepgramSTTCallback) PushAudioByte(audio []byte) {
-	c.dgClient.Write(audio)
+// Defaults used when the agent does not choose a model or language
+const (
+	DefaultSTTModel    = "nova-2"
+	DefaultSTTLanguage = "hi"
+)
+
+// STTConfig configures live transcription, zero values use the defaults
+type STTConfig struct {
+	APIKey         string `json:"api_key"` // DEEPGRAM_API_KEY when empty
+	Model          string `json:"model"`
+	Language       string `json:"language"`
+	Encoding       string `json:"encoding"`
+	SampleRate     int    `json:"sample_rate"`
+	UtteranceEndMs int    `json:"utterance_end_ms"` // silence after which an utterance is over
+	// Keywords are boosted words, "word" or "word:boost" with a boost of -10 to 10 (nova-2 and older)
+	Keywords []string `json:"keywords"`
+}
+
+// DefaultSTTConfig matches the μ-law 8kHz audio of Twilio media streams
+func DefaultSTTConfig() STTConfig {
+	return STTConfig{
+		Model:          DefaultSTTModel,
+		Language:       DefaultSTTLanguage,
+		Encoding:       "mulaw",
+		SampleRate:     8000,
+		UtteranceEndMs: 1000,
+	}
+}
+
+func (cfg STTConfig) withDefaults() STTConfig {
+	defaults := DefaultSTTConfig()
+	if cfg.APIKey == "" {
+		cfg.APIKey = os.Getenv("DEEPGRAM_API_KEY")
+	}
+	if cfg.Model == "" {
+		cfg.Model = defaults.Model
+	}
+	if cfg.Language == "" {
+		cfg.Language = defaults.Language
+	}
+	if cfg.Encoding == "" {
+		cfg.Encoding = defaults.Encoding
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	if cfg.UtteranceEndMs == 0 {
+		cfg.UtteranceEndMs = defaults.UtteranceEndMs
+	}
+	return cfg
 }
 
-func InitSTT() *DeepgramSTTCallback {
+// InitSTT creates a live transcription client
+func InitSTT(cfg STTConfig) *DeepgramSTTCallback {
+	cfg = cfg.withDefaults()
 
 	/*
 		DG Streaming API
@@ -197,9 +365,6 @@ func InitSTT() *DeepgramSTTCallback {
 	// 	LogLevel: client.LogLevelDefault, // LogLevelDefault, LogLevelFull, LogLevelDebug, LogLevelTrace
 	// })
 
-	// Go context
-	ctx := context.Background()
-
 	// client options
 	cOptions := &interfaces.ClientOptions{
 		EnableKeepAlive: true,
@@ -207,14 +372,15 @@ func InitSTT() *DeepgramSTTCallback {
 
 	// set the Transcription options
 	tOptions := &interfaces.LiveTranscriptionOptions{
-		Model: "nova-2", //nova-3
+		Model: cfg.Model, //nova-3
 		// Keyterm:     []string{"deepgram"},
-		Language: "hi",
+		Keywords: cfg.Keywords,
+		Language: cfg.Language,
 
 		Punctuate:   true,
-		Encoding:    "mulaw",
+		Encoding:    cfg.Encoding,
 		Channels:    1,
-		SampleRate:  8000,
+		SampleRate:  cfg.SampleRate,
 		SmartFormat: true,
 		VadEvents:   true,
 		// Endpointing: "500",
@@ -224,7 +390,7 @@ func InitSTT() *DeepgramSTTCallback {
 
 		// To get UtteranceEnd, the following must be set:
 		InterimResults: true,
-		UtteranceEndMs: "1000",
+		UtteranceEndMs: strconv.Itoa(cfg.UtteranceEndMs),
 	}
 
 	// example on how to send a custom parameter
@@ -232,24 +398,17 @@ func InitSTT() *DeepgramSTTCallback {
 	// params["dictation"] = []string{"true"}
 	// ctx = interfaces.WithCustomParameters(ctx, params)
 	dc := &DeepgramSTTCallback{
-		sb: &strings.Builder{},
+		events: make(chan domain.TranscriptEvent, eventBuffer),
+		done:   make(chan struct{}),
 	}
-	// Get Deepgram API key from environment
-	apiKey := os.Getenv("DEEPGRAM_API_KEY")
-	if apiKey == "" {
+	if cfg.APIKey == "" {
 		fmt.Println("ERROR: DEEPGRAM_API_KEY environment variable not set")
 		return nil
 	}
 
-	// Create a Deepgram client
-	dgClient, err := client.NewWSUsingCallback(ctx, apiKey, cOptions, tOptions, dc)
-	if err != nil {
-		fmt.Println("ERROR creating LiveTranscription connection:", err)
-		return nil
+	// every connection, including reconnects, gets a new Deepgram client
+	dc.newClient = func(ctx context.Context, callback api.LiveMessageCallback) (*websocketv1.WSCallback, error) {
+		return client.NewWSUsingCallback(ctx, cfg.APIKey, cOptions, tOptions, callback)
 	}
-	dc.dgClient = dgClient
-	dc.UserSaid = &UserSaid{}
-	go dc.UserSaid.MonitorAndTrigger()
-	// implement your own callback
 	return dc
 }
@@ -2,246 +2,527 @@ package deepgram
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+	"twilio-go-stream/domain"
 
 	msginterfaces "github.com/deepgram/deepgram-go-sdk/pkg/api/speak/v1/websocket/interfaces"
 	interfaces "github.com/deepgram/deepgram-go-sdk/pkg/client/interfaces/v1"
 	speak "github.com/deepgram/deepgram-go-sdk/pkg/client/speak"
 	websocketv1 "github.com/deepgram/deepgram-go-sdk/pkg/client/speak/v1/websocket"
-	"github.com/gorilla/websocket"
 )
 
+// ttsMessage is what the SDK callbacks report to the router, in the order Deepgram sent it
+type ttsMessage struct {
+	audio    []byte
+	flushed  bool            // all the audio of the oldest request was sent
+	cleared  bool            // Deepgram confirmed a Clear, audio received before it is stale
+	dropped  bool            // the connection dropped, the pending requests get no more audio
+	released []*speakRequest // cancelled requests, only the router closes their channels
+}
+
+// speakRequest is a text sent to Deepgram whose audio is not complete yet
+type speakRequest struct {
+	ctx      context.Context
+	out      chan domain.AudioChunk
+	done     chan struct{} // closed with out
+	doneOnce sync.Once
+}
+
+// finish completes the request, only the router calls it until the router has exited
+func (r *speakRequest) finish() {
+	r.doneOnce.Do(func() {
+		close(r.out)
+		close(r.done)
+	})
+}
+
+// ErrTTSUnavailable is returned once reconnecting to Deepgram failed
+var ErrTTSUnavailable = errors.New("deepgram TTS connection lost")
+
+// MyCallback speaks texts with Deepgram over a websocket. A dropped connection is reopened with
+// exponential backoff, texts sent meanwhile wait for it.
 type MyCallback struct {
-	wsConn         *websocket.Conn
-	streamId       string
-	audioBuffer    Queue
-	ChanBuff       chan []byte
-	dgClient       *websocketv1.WSCallback
-	exit           chan struct{}
-	writeMutex     sync.Mutex
-	cancelWriter   context.CancelFunc
-	stopProcessing bool // New flag to stop sending audio
+	ChanBuff  chan ttsMessage
+	newClient func(callback msginterfaces.SpeakMessageCallback) (*websocketv1.WSCallback, error)
+
+	sendMu      sync.Mutex // held while texts or a Clear are sent to Deepgram
+	mu          sync.Mutex
+	dgClient    *websocketv1.WSCallback
+	generation  int             // bumped for every connection, callbacks of older ones are ignored
+	connected   bool            // false while reconnecting
+	reconnected chan struct{}   // closed when reconnecting ends, whether it worked or not
+	failed      bool            // reconnecting gave up
+	requests    []*speakRequest // in the order the texts were sent
+	clearing    bool            // a Clear was sent and not yet confirmed
+	done        chan struct{}
+	routed      chan struct{} // closed once the router has exited
+	stopOnce    sync.Once
 }
 
-func (c *MyCallback) Disconnect() {
-	fmt.Println("[Disconnect] Cleaning up resources...")
+// ttsConnection tells the callbacks of one Deepgram connection apart from the next one
+type ttsConnection struct {
+	*MyCallback
+	generation int
+}
 
-	// Stop Deepgram client
-	if c.dgClient != nil {
-		c.dgClient.Stop()
+// Close is called by the SDK when the connection ends, including when it drops
+func (c *ttsConnection) Close(cr *msginterfaces.CloseResponse) error {
+	fmt.Println("[Close] Connection closed by Deepgram")
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	c.mu.Lock()
+	current := c.MyCallback.generation == c.generation && c.connected
+	if current {
+		c.connected = false
+		c.reconnected = make(chan struct{})
+	}
+	c.mu.Unlock()
+	if !current {
+		return nil
 	}
 
-	if c.wsConn != nil {
-		_ = c.wsConn.Close()
-
+	// queued behind the audio of the connection, the router fails what is still pending
+	select {
+	case c.ChanBuff <- ttsMessage{dropped: true}:
+	case <-c.done:
 	}
+	// the SDK holds its connection lock here, reconnecting must happen elsewhere
+	go c.reconnect()
+	return nil
+}
 
+// Disconnect closes the Deepgram connection
+func (c *MyCallback) Disconnect() {
+	fmt.Println("[Disconnect] Cleaning up resources...")
+	c.Stop()
 	fmt.Println("[Disconnect] Cleanup complete. All resources freed.")
 }
 
-func (c MyCallback) Open(or *msginterfaces.OpenResponse) error {
+func (c *MyCallback) Open(or *msginterfaces.OpenResponse) error {
 	fmt.Println("[Open] Connection Established")
 	return nil
 }
 
-func (c MyCallback) Metadata(md *msginterfaces.MetadataResponse) error {
+func (c *MyCallback) Metadata(md *msginterfaces.MetadataResponse) error {
 	fmt.Printf("[Metadata] Request ID: %s\n", strings.TrimSpace(md.RequestID))
 	return nil
 }
 
-func (c MyCallback) Binary(byMsg []byte) error {
+func (c *MyCallback) Binary(byMsg []byte) error {
 	fmt.Println("[Binary] Received audio data")
-	c.ChanBuff <- byMsg
+	c.deliver(ttsMessage{audio: byMsg})
 	return nil
 }
 
-func (c MyCallback) Flush(fl *msginterfaces.FlushedResponse) error {
+func (c *MyCallback) Flush(fl *msginterfaces.FlushedResponse) error {
 	fmt.Println("[Flushed] Received")
+	c.deliver(ttsMessage{flushed: true})
 	return nil
 }
 
-func (c MyCallback) Clear(fl *msginterfaces.ClearedResponse) error {
+func (c *MyCallback) Clear(fl *msginterfaces.ClearedResponse) error {
 	fmt.Println("[Cleared] Received")
-	c.dgClient.Finish()
+	c.deliver(ttsMessage{cleared: true})
 	return nil
 }
 
-func (c MyCallback) Close(cr *msginterfaces.CloseResponse) error {
-	fmt.Println("[Close] Connection closed by Deepgram")
+// deliver queues msg for the router, it gives up once the client is stopped so the SDK is never blocked
+func (c *MyCallback) deliver(msg ttsMessage) {
+	select {
+	case c.ChanBuff <- msg:
+	case <-c.done:
+	}
+}
+
+func (c *MyCallback) Close(cr *msginterfaces.CloseResponse) error {
+	// connections are opened with ttsConnection, which handles the close
 	return nil
 }
 
-func (c MyCallback) Warning(wr *msginterfaces.WarningResponse) error {
+func (c *MyCallback) Warning(wr *msginterfaces.WarningResponse) error {
 	fmt.Printf("[Warning] Code: %s | Description: %s\n", wr.WarnCode, wr.WarnMsg)
 	return nil
 }
 
-func (c MyCallback) Error(er *msginterfaces.ErrorResponse) error {
+func (c *MyCallback) Error(er *msginterfaces.ErrorResponse) error {
 	fmt.Printf("[Error] Code: %s | Description: %s\n", er.ErrCode, er.ErrMsg)
 	return nil
 }
 
-func (c MyCallback) UnhandledEvent(byData []byte) error {
+func (c *MyCallback) UnhandledEvent(byData []byte) error {
 	fmt.Printf("[UnhandledEvent] %s\n", string(byData))
 	return nil
 }
 
-func (c *MyCallback) ConnectTTS() {
-	if c.dgClient == nil {
-		fmt.Println("Deepgram client is not initialized.")
-		return
+// ConnectTTS opens the connection to Deepgram
+func (c *MyCallback) ConnectTTS() error {
+	if c.newClient == nil {
+		return fmt.Errorf("deepgram TTS client is not initialized")
 	}
-
-	if !c.dgClient.Connect() {
-		fmt.Println("Failed to connect to Deepgram")
-		os.Exit(1)
+	if err := c.connect(); err != nil {
+		return err
 	}
 	fmt.Println("Connected to Deepgram TTS service")
+	return nil
 }
 
-// Singleton initialization
-var (
-	initOnce         sync.Once
-	callbackInstance *MyCallback
-)
+// connect opens a new connection, texts are sent to it from now on
+func (c *MyCallback) connect() error {
+	c.mu.Lock()
+	c.generation++
+	generation := c.generation
+	c.mu.Unlock()
+
+	dgClient, err := c.newClient(&ttsConnection{MyCallback: c, generation: generation})
+	if err != nil {
+		return fmt.Errorf("creating Deepgram TTS client: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	// a single attempt, retries are done here with backoff instead of the SDK's fixed delay
+	if !dgClient.ConnectWithCancel(ctx, cancel, 1) {
+		cancel()
+		return fmt.Errorf("connecting to Deepgram TTS failed")
+	}
+
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		dgClient.Stop()
+		return fmt.Errorf("deepgram TTS client stopped")
+	default:
+	}
+	old := c.dgClient
+	c.dgClient = dgClient
+	c.connected = true
+	c.mu.Unlock()
+	if old != nil {
+		// stopping keeps the SDK from reconnecting the old client on its own
+		go old.Stop()
+	}
+	return nil
+}
+
+func (c *MyCallback) reconnect() {
+	log.Println("Deepgram TTS connection dropped, reconnecting")
+	delay := reconnectDelay
+	for attempt := 1; attempt <= reconnectAttempts; attempt++ {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(delay):
+		}
+		err := c.connect()
+		if err == nil {
+			log.Printf("Deepgram TTS reconnected after %d attempts", attempt)
+			c.mu.Lock()
+			close(c.reconnected)
+			c.mu.Unlock()
+			return
+		}
+		log.Printf("Deepgram TTS reconnect attempt %d failed: %v", attempt, err)
+		delay *= 2
+	}
+	log.Printf("Giving up on Deepgram TTS after %d attempts", reconnectAttempts)
+	c.mu.Lock()
+	c.failed = true
+	close(c.reconnected)
+	c.mu.Unlock()
+}
+
+// client returns the connection to send texts to, waiting while it is reopened
+func (c *MyCallback) client(ctx context.Context) (*websocketv1.WSCallback, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for !c.connected {
+		switch {
+		case c.failed:
+			return nil, ErrTTSUnavailable
+		case c.reconnected == nil:
+			return nil, fmt.Errorf("deepgram TTS is not connected")
+		}
+		reconnected := c.reconnected
+		c.mu.Unlock()
+		select {
+		case <-reconnected:
+		case <-ctx.Done():
+			c.mu.Lock()
+			return nil, ctx.Err()
+		case <-c.done:
+			c.mu.Lock()
+			return nil, fmt.Errorf("deepgram TTS client stopped")
+		}
+		c.mu.Lock()
+	}
+	return c.dgClient, nil
+}
+
+// DefaultVoice is the Aura voice used when the agent does not choose one
+const DefaultVoice = "aura-asteria-en"
 
-func Init() *MyCallback {
-	// initOnce.Do(func() {
+// TTSConfig configures speech synthesis, zero values use the defaults
+type TTSConfig struct {
+	APIKey     string `json:"api_key"` // DEEPGRAM_API_KEY when empty
+	Voice      string `json:"voice"`
+	Encoding   string `json:"encoding"`
+	SampleRate int    `json:"sample_rate"`
+}
+
+// DefaultTTSConfig produces audio Twilio plays as is, μ-law at 8kHz
+func DefaultTTSConfig() TTSConfig {
+	return TTSConfig{Voice: DefaultVoice, Encoding: "mulaw", SampleRate: 8000}
+}
+
+func (cfg TTSConfig) withDefaults() TTSConfig {
+	defaults := DefaultTTSConfig()
+	if cfg.APIKey == "" {
+		cfg.APIKey = os.Getenv("DEEPGRAM_API_KEY")
+	}
+	if cfg.Voice == "" {
+		cfg.Voice = defaults.Voice
+	}
+	if cfg.Encoding == "" {
+		cfg.Encoding = defaults.Encoding
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	return cfg
+}
+
+// Init creates a TTS client
+func Init(cfg TTSConfig) *MyCallback {
+	cfg = cfg.withDefaults()
 	cOptions := &interfaces.ClientOptions{}
 	ttsOptions := &interfaces.WSSpeakOptions{
-		Model:      "aura-asteria-en",
-		Encoding:   "mulaw",
-		SampleRate: 8000,
+		Model:      cfg.Voice,
+		Encoding:   cfg.Encoding,
+		SampleRate: cfg.SampleRate,
 	}
-	callback := MyCallback{ChanBuff: make(chan []byte, 2000)}
+	callback := &MyCallback{ChanBuff: make(chan ttsMessage, 2000), done: make(chan struct{}), routed: make(chan struct{})}
 
-	// Get Deepgram API key from environment
-	apiKey := os.Getenv("DEEPGRAM_API_KEY")
-	if apiKey == "" {
+	if cfg.APIKey == "" {
 		fmt.Println("ERROR: DEEPGRAM_API_KEY environment variable not set")
-		return &callback
+		return nil
 	}
 
-	dgClient, err := speak.NewWSUsingCallback(context.Background(), apiKey, cOptions, ttsOptions, callback)
-	if err != nil {
-		fmt.Println("ERROR creating TTS connection:", err)
-		return &callback
+	// every connection, including reconnects, gets a new Deepgram client
+	callback.newClient = func(cb msginterfaces.SpeakMessageCallback) (*websocketv1.WSCallback, error) {
+		return speak.NewWSUsingCallback(context.Background(), cfg.APIKey, cOptions, ttsOptions, cb)
 	}
-
-	callback.dgClient = dgClient
+	go callback.route()
 	fmt.Println("Deepgram TTS client initialized")
-	callbackInstance = &callback
-	//	})
-	return callbackInstance
+	return callback
 }
 
-func (c *MyCallback) StreamTTSDeepGram(ctx context.Context, m string, wsConn *websocket.Conn, sid string) {
-	c.wsConn = wsConn
-	c.streamId = sid
-	fmt.Println("Agent", m)
+// Synthesize sends text to Deepgram, its μ-law audio is sent on the returned channel.
+// Cancelling ctx clears everything Deepgram has not spoken yet.
+func (c *MyCallback) Synthesize(ctx context.Context, text string) (<-chan domain.AudioChunk, error) {
+	dgClient, err := c.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &speakRequest{ctx: ctx, out: make(chan domain.AudioChunk, 64), done: make(chan struct{})}
+
+	// the requests must be in the order Deepgram receives the texts, and a Clear must not
+	// land between a text and its flush
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		// the router is gone, nobody would complete the request
+		c.mu.Unlock()
+		return nil, fmt.Errorf("deepgram TTS client stopped")
+	default:
+	}
+	c.requests = append(c.requests, req)
+	c.mu.Unlock()
 
-	// Stop previous writer if active
-	if c.cancelWriter != nil {
-		fmt.Println("[Pause] Stopping previous process...")
-		c.stopProcessing = true            // Prevents audio sending
-		time.Sleep(500 * time.Millisecond) // Small pause before restarting
-		c.cancelWriter()
+	if err := dgClient.SpeakWithText(text); err != nil {
+		c.clear()
+		return nil, fmt.Errorf("sending text: %w", err)
+	}
+	// flushing after every text makes Deepgram report where its audio ends
+	if err := dgClient.Flush(); err != nil {
+		c.clear()
+		return nil, fmt.Errorf("sending flush: %w", err)
 	}
 
-	c.exit = make(chan struct{})
-	var newCtx context.Context
-	newCtx, c.cancelWriter = context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.cancel(req)
+		case <-req.done:
+		case <-c.done:
+		}
+	}()
+	return req.out, nil
+}
 
-	// Clear buffer to prevent duplicate audio
-	c.clearChannelBuffer()
+// cancel clears Deepgram unless req was already dropped, requests of one turn share a context
+// and a single Clear covers all of them
+func (c *MyCallback) cancel(req *speakRequest) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.mu.Lock()
+	pending := slices.Contains(c.requests, req)
+	c.mu.Unlock()
+	if pending {
+		c.clear()
+	}
+}
 
-	// Reset processing flag and start audio streaming
-	c.stopProcessing = false
-	go c.PushAudioToWs(newCtx)
+// Cancel drops every pending request and clears the text still queued at Deepgram
+func (c *MyCallback) Cancel() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.clear()
+}
 
-	if c.dgClient == nil {
-		fmt.Println("It's nill")
+// clear is Cancel with sendMu held
+func (c *MyCallback) clear() {
+	c.mu.Lock()
+	dropped := c.requests
+	c.requests = nil
+	dgClient, connected := c.dgClient, c.connected
+	// a dropped connection has nothing queued
+	c.clearing = connected
+	c.mu.Unlock()
+
+	// requests of another turn may be dropped too, the router ends them so nobody waits forever
+	if len(dropped) > 0 {
+		select {
+		case c.ChanBuff <- ttsMessage{released: dropped}:
+		case <-c.done:
+		}
+		select {
+		case <-c.done:
+			// the router may have exited before seeing them
+			<-c.routed
+			for _, req := range dropped {
+				req.finish()
+			}
+		default:
+		}
 	}
-	if err := c.dgClient.SpeakWithText(m); err != nil {
-		fmt.Printf("Error sending text input: %v\n", err)
+	if !connected {
 		return
 	}
-	if err := c.dgClient.Flush(); err != nil {
-		fmt.Printf("Error sending flush signal: %v\n", err)
-		return
+	if err := dgClient.WSClient.WriteJSON(map[string]string{"type": "Clear"}); err != nil {
+		log.Println("Failed to send Clear to Deepgram:", err)
+		// no confirmation will come, audio must not stay muted
+		c.mu.Lock()
+		c.clearing = false
+		c.mu.Unlock()
 	}
+}
 
-	<-c.exit
-	c.dgClient.Stop()
-	fmt.Println("Streaming process finished.")
+// Stop closes the connection to Deepgram
+func (c *MyCallback) Stop() {
+	c.stopOnce.Do(func() {
+		if c.done != nil {
+			close(c.done)
+		}
+		c.mu.Lock()
+		dgClient := c.dgClient
+		c.connected = false
+		c.mu.Unlock()
+		if dgClient != nil {
+			dgClient.Stop()
+		}
+	})
 }
 
-func (c *MyCallback) PushAudioToWs(ctx context.Context) {
+// route hands the audio Deepgram sends to the oldest pending request, a flush completes it.
+// Cancelled requests are completed once the audio routed before the Clear was delivered, and a
+// dropped connection completes every pending request with the audio received so far.
+func (c *MyCallback) route() {
+	defer close(c.routed)
+	defer c.releasePending()
 	for {
+		var msg ttsMessage
 		select {
-		case <-c.exit:
-			fmt.Println("[StreamTTSDeepGram] Exit signal received. Stopping processing.")
+		case <-c.done:
 			return
+		case msg = <-c.ChanBuff:
+		}
 
-		case <-ctx.Done():
-			fmt.Println("[Stopping] Audio writer goroutine")
-			return
-		case audioData := <-c.ChanBuff:
-			if c.stopProcessing {
-				fmt.Println("[Skipped] Ignoring audio chunk due to interruption.")
-				return
+		if len(msg.released) > 0 {
+			for _, req := range msg.released {
+				req.finish()
 			}
-			fmt.Println("[Playing] Audio data chunk")
-
-			c.writeMutex.Lock()
-			muLawAudio := audioData
-			chunkSize := 160
-
-			for i := 0; i < len(muLawAudio); i += chunkSize {
-				end := i + chunkSize
-				if end > len(muLawAudio) {
-					end = len(muLawAudio)
-				}
-				chunk := muLawAudio[i:end]
-				payload := base64.StdEncoding.EncodeToString(chunk)
-
-				message := map[string]interface{}{
-					"event":     "media",
-					"streamSid": c.streamId,
-					"media": map[string]string{
-						"track":   "audio",
-						"payload": payload,
-					},
-				}
-
-				if err := c.wsConn.WriteJSON(message); err != nil {
-					fmt.Println("[Error] Failed to send WebSocket message:", err)
-					c.writeMutex.Unlock()
-					return
-				}
-
-				time.Sleep(18 * time.Millisecond) // Smooth audio streaming
-
-				// Stop inner loop if interruption is detected
-				if c.stopProcessing {
-					fmt.Println("[Paused] Stopped sending further audio chunks.")
-					break
-				}
+			continue
+		}
+
+		c.mu.Lock()
+		if msg.dropped {
+			requests := c.requests
+			c.requests = nil
+			c.clearing = false
+			c.mu.Unlock()
+			for _, req := range requests {
+				req.finish()
 			}
-			c.writeMutex.Unlock()
+			continue
+		}
+		if msg.cleared {
+			c.clearing = false
+			c.mu.Unlock()
+			continue
+		}
+		if c.clearing || len(c.requests) == 0 {
+			// audio of a cleared request
+			c.mu.Unlock()
+			continue
+		}
+		req := c.requests[0]
+		if msg.flushed {
+			c.requests = c.requests[1:]
+		}
+		c.mu.Unlock()
+
+		if msg.flushed {
+			req.finish()
+			continue
+		}
+		select {
+		case req.out <- domain.AudioChunk{Encoding: domain.AudioMuLaw, Data: msg.audio}:
+		case <-req.ctx.Done():
+		case <-c.done:
+			return
 		}
 	}
 }
 
-// Clears all old audio chunks from the buffer
-func (c *MyCallback) clearChannelBuffer() {
-	for len(c.ChanBuff) > 0 {
-		<-c.ChanBuff
+// releasePending completes the requests still pending when the client is stopped, so nobody
+// waits for their audio forever
+func (c *MyCallback) releasePending() {
+	c.mu.Lock()
+	requests := c.requests
+	c.requests = nil
+	c.mu.Unlock()
+	for _, req := range requests {
+		req.finish()
+	}
+	for {
+		select {
+		case msg := <-c.ChanBuff:
+			for _, req := range msg.released {
+				req.finish()
+			}
+		default:
+			return
+		}
 	}
-	fmt.Println("[Cleared] Old audio buffer cleaned.")
 }
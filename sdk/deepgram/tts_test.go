@@ -0,0 +1,123 @@
+package deepgram
+
+import (
+	"context"
+	"testing"
+	"time"
+	"twilio-go-stream/domain"
+)
+
+func newTestCallback() *MyCallback {
+	c := &MyCallback{ChanBuff: make(chan ttsMessage, 16), done: make(chan struct{}), routed: make(chan struct{})}
+	go c.route()
+	return c
+}
+
+func pending(c *MyCallback, ctx context.Context) *speakRequest {
+	req := &speakRequest{ctx: ctx, out: make(chan domain.AudioChunk, 64), done: make(chan struct{})}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.mu.Unlock()
+	return req
+}
+
+func waitClosed(t *testing.T, out <-chan domain.AudioChunk) []domain.AudioChunk {
+	t.Helper()
+	var chunks []domain.AudioChunk
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case chunk, ok := <-out:
+			if !ok {
+				return chunks
+			}
+			chunks = append(chunks, chunk)
+		case <-timeout:
+			t.Fatal("request was never completed")
+		}
+	}
+}
+
+func TestRouteSplitsAudioOnFlush(t *testing.T) {
+	c := newTestCallback()
+	defer c.Stop()
+	first, second := pending(c, context.Background()), pending(c, context.Background())
+
+	c.ChanBuff <- ttsMessage{audio: []byte{1}}
+	c.ChanBuff <- ttsMessage{audio: []byte{2}}
+	c.ChanBuff <- ttsMessage{flushed: true}
+	c.ChanBuff <- ttsMessage{audio: []byte{3}}
+	c.ChanBuff <- ttsMessage{flushed: true}
+
+	if got := waitClosed(t, first.out); len(got) != 2 || got[1].Data[0] != 2 {
+		t.Fatalf("first request got %v", got)
+	}
+	if got := waitClosed(t, second.out); len(got) != 1 || got[0].Data[0] != 3 {
+		t.Fatalf("second request got %v", got)
+	}
+}
+
+func TestCancelCompletesEveryPendingRequest(t *testing.T) {
+	c := newTestCallback()
+	defer c.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	old := pending(c, ctx)
+	// a request of the next turn sent before the old turn was cancelled
+	next := pending(c, context.Background())
+
+	cancel()
+	c.cancel(old)
+	waitClosed(t, old.out)
+	waitClosed(t, next.out)
+
+	// cancelling again is a no-op, the request is no longer pending
+	c.cancel(old)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.requests) != 0 || c.clearing {
+		t.Fatalf("unexpected state: %d requests, clearing %v", len(c.requests), c.clearing)
+	}
+}
+
+func TestDroppedConnectionCompletesRequests(t *testing.T) {
+	c := newTestCallback()
+	defer c.Stop()
+	req := pending(c, context.Background())
+
+	c.ChanBuff <- ttsMessage{audio: []byte{1}}
+	c.ChanBuff <- ttsMessage{dropped: true}
+	if got := waitClosed(t, req.out); len(got) != 1 {
+		t.Fatalf("expected the audio received before the drop, got %v", got)
+	}
+}
+
+func TestCallbacksDoNotBlockAfterStop(t *testing.T) {
+	// no router reads the channel, as after Stop
+	c := &MyCallback{ChanBuff: make(chan ttsMessage), done: make(chan struct{})}
+	close(c.done)
+
+	returned := make(chan struct{})
+	go func() {
+		c.Binary([]byte{1})
+		c.Flush(nil)
+		c.Clear(nil)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("callback blocked after stop")
+	}
+}
+
+func TestStopCompletesPendingRequests(t *testing.T) {
+	c := newTestCallback()
+	req := pending(c, context.Background())
+	c.ChanBuff <- ttsMessage{audio: []byte{1}}
+
+	c.Stop()
+	waitClosed(t, req.out)
+	if _, err := c.Synthesize(context.Background(), "Hello."); err == nil {
+		t.Fatal("a stopped client accepted a text")
+	}
+}
@@ -0,0 +1,85 @@
+package gcp
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// SSMLInstructions are added to the system prompt of agents whose voice accepts SSML
+const SSMLInstructions = `You may mark up your replies with SSML: <break time="300ms"/> for a pause, ` +
+	`<emphasis>word</emphasis> to stress a word and <say-as interpret-as="cardinal|ordinal|characters|telephone|date|time">...</say-as> ` +
+	`for numbers, spelled out codes, phone numbers, dates and times. Open and close every tag within the same sentence, ` +
+	`escape & as &amp; and never write <speak>.`
+
+// ssmlElements are the SSML elements passed to Google, anything else falls back to plain text
+var ssmlElements = map[string]bool{
+	"speak": true, "break": true, "emphasis": true, "say-as": true, "prosody": true,
+	"sub": true, "p": true, "s": true, "lang": true,
+}
+
+// hasMarkup reports whether text looks like it contains SSML
+func hasMarkup(text string) bool {
+	return strings.Contains(text, "<")
+}
+
+// ssmlDocument wraps text in <speak> unless it already is a document, and checks it is well formed
+// and only uses the supported elements
+func ssmlDocument(text string) (string, error) {
+	doc := strings.TrimSpace(text)
+	if !strings.HasPrefix(doc, "<speak") {
+		doc = "<speak>" + doc + "</speak>"
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(doc))
+	depth, roots := 0, 0
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if !ssmlElements[name] {
+				return "", fmt.Errorf("unsupported SSML element <%s>", name)
+			}
+			if (depth == 0) != (name == "speak") {
+				return "", fmt.Errorf("<speak> must be the only root element")
+			}
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && strings.TrimSpace(string(t)) != "" {
+				return "", fmt.Errorf("text outside <speak>")
+			}
+		}
+	}
+	if roots != 1 {
+		return "", fmt.Errorf("<speak> must be the only root element")
+	}
+	return doc, nil
+}
+
+var (
+	markup           = regexp.MustCompile(`<[^>]*>`)
+	spaceBeforePunct = regexp.MustCompile(`\s+([.,!?;:।])`)
+)
+
+// stripMarkup turns text with SSML into the plain text it speaks
+func stripMarkup(text string) string {
+	plain := html.UnescapeString(markup.ReplaceAllString(text, " "))
+	plain = strings.Join(strings.Fields(plain), " ")
+	return spaceBeforePunct.ReplaceAllString(plain, "$1")
+}
@@ -0,0 +1,50 @@
+package gcp
+
+import "testing"
+
+func TestSSMLDocument(t *testing.T) {
+	valid := map[string]string{
+		`Your code is <say-as interpret-as="characters">AB12</say-as>.`: `<speak>Your code is <say-as interpret-as="characters">AB12</say-as>.</speak>`,
+		`<speak>Hold on <break time="300ms"/> please.</speak>`:          `<speak>Hold on <break time="300ms"/> please.</speak>`,
+	}
+	for text, want := range valid {
+		got, err := ssmlDocument(text)
+		if err != nil || got != want {
+			t.Errorf("ssmlDocument(%q) = %q, %v", text, got, err)
+		}
+	}
+
+	invalid := []string{
+		`It is <emphasis>really important.`,        // split across sentences
+		`Tom & Jerry <break time="1s"/>`,           // unescaped &
+		`<audio src="https://example.com/a.mp3"/>`, // not supported
+		`<speak>one</speak><speak>two</speak>`,
+	}
+	for _, text := range invalid {
+		if doc, err := ssmlDocument(text); err == nil {
+			t.Errorf("ssmlDocument(%q) accepted as %q", text, doc)
+		}
+	}
+}
+
+func TestStripMarkup(t *testing.T) {
+	got := stripMarkup(`Call <say-as interpret-as="telephone">555 0100</say-as>, Tom &amp; Jerry<break time="1s"/>answer.`)
+	if want := "Call 555 0100, Tom & Jerry answer."; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestTTSConfigValidate(t *testing.T) {
+	cfg := DefaultTTSConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.SpeakingRate = 5
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("speaking rate 5 accepted")
+	}
+	cfg.SpeakingRate, cfg.Pitch = 1.2, -25
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("pitch -25 accepted")
+	}
+}
@@ -5,38 +5,184 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	audio_translator "twilio-go-stream/audio-translation"
+	"twilio-go-stream/domain"
 
 	speech "cloud.google.com/go/speech/apiv1"
-	"github.com/gorilla/websocket"
 	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
 )
 
 const (
-	sampleRate   = 8000 // Twilio sends μ-law audio at 8kHz
-	chunkSize    = 320  // Twilio audio chunk size (~20ms audio per chunk)
+	chunkSize    = 320 // Twilio audio chunk size (~20ms audio per chunk)
 	channelCount = 1
 )
 
-// GoogleSTTClient handles the STT streaming with a callback approach similar to Deepgram
+// eventBuffer holds transcript events until the call reads them
+const eventBuffer = 64
+
+const (
+	// streamLimit rotates the stream before Google ends it at about five minutes
+	streamLimit = 4*time.Minute + 30*time.Second
+	// replayDuration of audio already sent is sent again to a new stream, a word spoken across
+	// the boundary is then heard whole by one of the two streams
+	replayDuration = 300 * time.Millisecond
+	// drainTimeout bounds how long a rotated out stream may deliver its last results
+	drainTimeout = 5 * time.Second
+	// Reopening a failed stream waits restartDelay, doubled after every failed attempt
+	restartDelay    = 250 * time.Millisecond
+	restartAttempts = 5
+	// maxGapSeconds of audio is kept while no stream is open, older audio is dropped
+	maxGapSeconds = 10
+)
+
+// recognizeStream is one StreamingRecognize call, a call uses a new one every few minutes
+type recognizeStream struct {
+	speechpb.Speech_StreamingRecognizeClient
+	cancel     context.CancelFunc
+	generation int
+	offset     time.Duration // call audio time of the first audio sent to the stream
+}
+
+// GoogleSTTClient streams caller audio to Google Cloud Speech and turns its results into transcript
+// events. Streams are rotated before Google's time limit and reopened when they fail.
 type GoogleSTTClient struct {
-	client         *speech.Client
-	stream         speechpb.Speech_StreamingRecognizeClient
-	ctx            context.Context
-	errChan        chan error
-	DataChan       chan []byte
-	WsConn         *websocket.Conn
-	Sid            string
-	AgentResponse  func(bool, string)
-	lastTranscript string
+	client   *speech.Client
+	open     func(ctx context.Context) (speechpb.Speech_StreamingRecognizeClient, error)
+	ctx      context.Context
+	cancel   context.CancelFunc
+	DataChan chan []byte
+	events   chan domain.TranscriptEvent
+	ended    chan int // generation of a stream that ended on its own
+	restarts atomic.Int64
+	cfg      STTConfig
+
+	mu           sync.Mutex
+	current      *recognizeStream
+	lastFinalEnd time.Duration // call audio time of the end of the last final
 }
 
 func (c *GoogleSTTClient) Close() {
-	c.client.Close()
+	if c.client != nil {
+		c.client.Close()
+	}
+}
+
+// Start opens the recognition stream, events are delivered until ctx is done or Stop is called
+func (c *GoogleSTTClient) Start(ctx context.Context) error {
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	first, err := c.openStream(1, 0, nil)
+	if err != nil {
+		c.cancel()
+		return err
+	}
+	go c.run(first)
+	return nil
+}
+
+// Write sends μ-law audio as received from Twilio, Google gets it as PCM16
+func (c *GoogleSTTClient) Write(audio []byte) error {
+	c.PushAudioByte(audio_translator.ConvertMuLawToPCM16(audio))
+	return nil
+}
+
+// Events returns the transcript events, the channel is never closed
+func (c *GoogleSTTClient) Events() <-chan domain.TranscriptEvent {
+	return c.events
+}
+
+// Restarts counts the attempts to replace a stream, rotations and failures alike
+func (c *GoogleSTTClient) Restarts() int {
+	return int(c.restarts.Load())
+}
+
+// Stop ends the recognition stream and closes the client
+func (c *GoogleSTTClient) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.Close()
+}
+
+// Defaults used when the agent does not choose a language or model
+const (
+	DefaultSTTLanguage = "en-IN"
+	DefaultSTTModel    = "default"
+)
+
+// STTConfig configures recognition, zero values use the defaults
+type STTConfig struct {
+	Language             string          `json:"language"`
+	Model                string          `json:"model"` // "phone_call" suits telephony audio, "latest_short" short answers
+	SampleRate           int             `json:"sample_rate"`
+	AlternativeLanguages []string        `json:"alternative_languages"`
+	Enhanced             bool            `json:"enhanced"` // the enhanced version of Model, billed higher
+	SpeechContexts       []SpeechContext `json:"speech_contexts"`
+}
+
+// MaxBoost is the highest boost Google accepts for a speech context
+const MaxBoost = 20
+
+// VocabularyBoost weighs the domain vocabulary of an agent
+const VocabularyBoost = 10
+
+// SpeechContext makes Google more likely to recognize its phrases, e.g. product or city names.
+// Boost is 0 to MaxBoost, 0 lets Google decide.
+type SpeechContext struct {
+	Phrases []string `json:"phrases"`
+	Boost   float32  `json:"boost"`
+}
+
+// Validate checks the boost is one Google accepts
+func (sc SpeechContext) Validate() error {
+	if sc.Boost < 0 || sc.Boost > MaxBoost {
+		return fmt.Errorf("speech context boost must be between 0 and %d, got %v", MaxBoost, sc.Boost)
+	}
+	if len(sc.Phrases) == 0 {
+		return fmt.Errorf("speech context has no phrases")
+	}
+	return nil
+}
+
+func speechContexts(contexts []SpeechContext) []*speechpb.SpeechContext {
+	var pb []*speechpb.SpeechContext
+	for _, sc := range contexts {
+		pb = append(pb, &speechpb.SpeechContext{Phrases: sc.Phrases, Boost: sc.Boost})
+	}
+	return pb
+}
+
+// DefaultSTTConfig matches Twilio's 8kHz audio, callers may also speak Hindi
+func DefaultSTTConfig() STTConfig {
+	return STTConfig{
+		Language:             DefaultSTTLanguage,
+		Model:                DefaultSTTModel,
+		SampleRate:           8000,
+		AlternativeLanguages: []string{"hi-IN"},
+		Enhanced:             true,
+	}
+}
+
+func (cfg STTConfig) withDefaults() STTConfig {
+	defaults := DefaultSTTConfig()
+	if cfg.Language == "" {
+		cfg.Language = defaults.Language
+	}
+	if cfg.Model == "" {
+		cfg.Model = defaults.Model
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = defaults.SampleRate
+	}
+	return cfg
 }
 
 // NewGoogleSTTClient initializes Google Cloud STT
-func NewGoogleSTTClient() (*GoogleSTTClient, error) {
+func NewGoogleSTTClient(cfg STTConfig) (*GoogleSTTClient, error) {
+	cfg = cfg.withDefaults()
 	// Open Google Cloud Speech Client
 	ctx := context.Background()
 	client, err := speech.NewClient(ctx)
@@ -46,38 +192,46 @@ func NewGoogleSTTClient() (*GoogleSTTClient, error) {
 	}
 
 	return &GoogleSTTClient{
-		client:   client,
+		client: client,
+		open: func(ctx context.Context) (speechpb.Speech_StreamingRecognizeClient, error) {
+			return client.StreamingRecognize(ctx)
+		},
 		ctx:      ctx,
-		errChan:  make(chan error, 10),   // Buffer for up to 10 errors
 		DataChan: make(chan []byte, 100), // Buffer for up to 100 audio chunks
+		events:   make(chan domain.TranscriptEvent, eventBuffer),
+		ended:    make(chan int, 1),
+		cfg:      cfg,
 	}, nil
 }
 
-func (c *GoogleSTTClient) StartStreamingAndAttach() {
+// openStream starts stream generation, sends the recognition config and replays audio already
+// sent to the previous stream. offset is the call audio time of the first byte of replay.
+func (c *GoogleSTTClient) openStream(generation int, offset time.Duration, replay []byte) (*recognizeStream, error) {
 	// Configure improved streaming request
 	streamingConfig := &speechpb.StreamingRecognitionConfig{
 		Config: &speechpb.RecognitionConfig{
 			Encoding:                   speechpb.RecognitionConfig_LINEAR16,
-			SampleRateHertz:            sampleRate,
-			LanguageCode:               "en-IN",
+			SampleRateHertz:            int32(c.cfg.SampleRate),
+			LanguageCode:               c.cfg.Language,
 			MaxAlternatives:            1,
 			EnableAutomaticPunctuation: true,
-			Model:                      "default", // Use 'phone_call' for telephony audio or 'default'
-			UseEnhanced:                true,      // Higher quality for audio
-			EnableWordTimeOffsets:      false,     // We don't need word timing
-			EnableWordConfidence:       false,     // We don't need word confidence
-			ProfanityFilter:            false,     // No profanity filter
-			AlternativeLanguageCodes:   []string{"hi-IN"},
+			Model:                      c.cfg.Model, // Use 'phone_call' for telephony audio or 'default'
+			UseEnhanced:                c.cfg.Enhanced,
+			EnableWordTimeOffsets:      true,  // Words replayed to a new stream are dropped by their timing
+			EnableWordConfidence:       false, // We don't need word confidence
+			ProfanityFilter:            false, // No profanity filter
+			AlternativeLanguageCodes:   c.cfg.AlternativeLanguages,
+			SpeechContexts:             speechContexts(c.cfg.SpeechContexts),
 		},
 		InterimResults:  true,  // Get partial results
 		SingleUtterance: false, // Don't stop after first utterance
 	}
 
-	// Start streaming
-	stream, err := c.client.StreamingRecognize(c.ctx)
+	ctx, cancel := context.WithCancel(c.ctx)
+	stream, err := c.open(ctx)
 	if err != nil {
-		log.Printf("Failed to start streaming: %v", err)
-		return
+		cancel()
+		return nil, fmt.Errorf("starting Google STT stream: %w", err)
 	}
 
 	// Send initial configuration
@@ -86,74 +240,239 @@ func (c *GoogleSTTClient) StartStreamingAndAttach() {
 			StreamingConfig: streamingConfig,
 		},
 	}); err != nil {
-		log.Printf("Failed to send config: %v", err)
-		return
+		cancel()
+		return nil, fmt.Errorf("sending Google STT config: %w", err)
+	}
+	if len(replay) > 0 {
+		if err := stream.Send(audioRequest(replay)); err != nil {
+			cancel()
+			return nil, fmt.Errorf("replaying audio to Google STT: %w", err)
+		}
 	}
 
-	c.stream = stream
-	log.Println("Google STT stream initialized successfully")
+	s := &recognizeStream{Speech_StreamingRecognizeClient: stream, cancel: cancel, generation: generation, offset: offset}
+	c.mu.Lock()
+	c.current = s
+	c.mu.Unlock()
+	go c.receive(s)
+	log.Printf("Google STT stream %d initialized successfully", generation)
+	return s, nil
 }
 
-// Transcribe processes Google STT responses with direct callback
-func (c *GoogleSTTClient) Transcribe() {
-	fmt.Println("Transcribing called")
+func audioRequest(audio []byte) *speechpb.StreamingRecognizeRequest {
+	return &speechpb.StreamingRecognizeRequest{
+		StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
+			AudioContent: audio,
+		},
+	}
+}
 
-	go func() {
-		for {
+// receive turns the responses of s into events until it ends. A stream ending while it is still
+// the current one is reported so it gets replaced.
+func (c *GoogleSTTClient) receive(s *recognizeStream) {
+	defer s.cancel()
+	for {
+		resp, err := s.Recv()
+		if err != nil {
+			c.mu.Lock()
+			current := c.current == s
+			c.mu.Unlock()
+			if !current || c.ctx.Err() != nil {
+				return
+			}
+			if err == io.EOF {
+				log.Printf("Google STT stream %d closed by server (EOF)", s.generation)
+			} else {
+				log.Printf("Google STT stream %d failed: %v", s.generation, err)
+			}
 			select {
+			case c.ended <- s.generation:
 			case <-c.ctx.Done():
-				fmt.Println("Context cancelled, stopping transcription")
-				return
+			}
+			return
+		}
+		c.processResults(s, resp)
+	}
+}
 
-			default:
-				resp, err := c.stream.Recv()
-				if err == io.EOF {
-					fmt.Println("Stream closed by server (EOF)")
-					return
-				}
-				if err != nil {
-					log.Printf("Error receiving from stream: %v", err)
-					return
+// run sends the caller's audio to the current stream and replaces the stream before its time
+// limit or when it fails
+func (c *GoogleSTTClient) run(s *recognizeStream) {
+	bytesPerSecond := 2 * c.cfg.SampleRate
+	replayBytes := int(replayDuration.Seconds() * float64(bytesPerSecond))
+	audioTime := func(n int) time.Duration {
+		return time.Duration(n) * time.Second / time.Duration(bytesPerSecond)
+	}
+
+	var (
+		sent        int    // bytes sent since the call started
+		recent      []byte // the last replayDuration of audio sent
+		audioBuffer = make([]byte, 0, 8192)
+		failures    int
+		delay       = restartDelay
+		retry       <-chan time.Time
+	)
+	rotation := time.NewTimer(streamLimit)
+	defer rotation.Stop()
+
+	// restart replaces s, on failure s is nil and another attempt is scheduled
+	restart := func(reason string) {
+		old := s
+		if old != nil {
+			// Google finalizes what it heard once the sending side is closed
+			old.CloseSend()
+			time.AfterFunc(drainTimeout, old.cancel)
+		}
+		generation := c.restarts.Add(1) + 1
+		var err error
+		s, err = c.openStream(int(generation), audioTime(sent-len(recent)), recent)
+		if err == nil {
+			log.Printf("Google STT stream restarted (%s), %d restarts so far", reason, generation-1)
+			failures, delay, retry = 0, restartDelay, nil
+			rotation.Reset(streamLimit)
+			return
+		}
+		c.mu.Lock()
+		c.current = nil
+		c.mu.Unlock()
+		failures++
+		log.Printf("Google STT restart attempt %d failed: %v", failures, err)
+		if failures >= restartAttempts {
+			log.Printf("Giving up on Google STT after %d attempts", failures)
+			c.emit(domain.TranscriptEvent{Type: domain.TranscriptFailed})
+			c.cancel()
+			return
+		}
+		retry = time.After(delay)
+		delay *= 2
+	}
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			fmt.Println("Context cancelled, stopping audio streaming")
+			if s != nil {
+				s.CloseSend()
+			}
+			return
+
+		case receivedData := <-c.DataChan:
+			// Add received data to buffer
+			audioBuffer = append(audioBuffer, receivedData...)
+			if s == nil {
+				// no stream to send to, keep the most recent audio for the next one
+				if max := maxGapSeconds * bytesPerSecond; len(audioBuffer) > max {
+					// counted as sent so later results stay on the call's audio time
+					sent += len(audioBuffer) - max
+					recent = nil
+					audioBuffer = append(audioBuffer[:0], audioBuffer[len(audioBuffer)-max:]...)
 				}
+				continue
+			}
 
-				// Process results and call agent response directly
-				c.processResults(resp)
+			// If we've accumulated enough data, send it
+			// Google recommends 100ms-400ms chunks for better recognition
+			if len(audioBuffer) < 3200 { // ~200ms of audio at 8kHz
+				continue
+			}
+			if err := s.Send(audioRequest(audioBuffer)); err != nil {
+				log.Printf("Error sending audio to Google: %v", err)
+				// the audio is kept and sent to the next stream
+				restart("send failed")
+				continue
+			}
+			sent += len(audioBuffer)
+			recent = append(recent, audioBuffer...)
+			if len(recent) > replayBytes {
+				recent = append([]byte(nil), recent[len(recent)-replayBytes:]...)
+			}
+			// Clear buffer after sending
+			audioBuffer = audioBuffer[:0]
+
+		case <-rotation.C:
+			restart("time limit")
+
+		case generation := <-c.ended:
+			if s != nil && generation == s.generation {
+				restart("stream ended")
 			}
-		}
-	}()
-}
 
-// processResults handles the STT response and calls the agent directly
-func (c *GoogleSTTClient) processResults(resp *speechpb.StreamingRecognizeResponse) {
-	if len(resp.Results) == 0 || len(resp.Results[0].Alternatives) == 0 {
-		return // Skip empty results
+		case <-retry:
+			restart("retry")
+		}
 	}
+}
 
+// processResults emits the results of a response of s. Google marks a result final at the end
+// of an utterance, so every final is followed by an UtteranceEnd. Results are placed on the
+// call's audio time, words a new stream heard again in the replayed audio are dropped.
+func (c *GoogleSTTClient) processResults(s *recognizeStream, resp *speechpb.StreamingRecognizeResponse) {
 	for _, result := range resp.Results {
-		if len(result.Alternatives) == 0 {
+		if len(result.Alternatives) == 0 || result.Alternatives[0].Transcript == "" {
 			continue
 		}
+		alternative := result.Alternatives[0]
+		ev := domain.TranscriptEvent{
+			Type:       domain.TranscriptPartial,
+			Text:       alternative.Transcript,
+			Confidence: float64(alternative.Confidence),
+			End:        s.offset + result.ResultEndTime.AsDuration(),
+		}
 
-		transcript := result.Alternatives[0].Transcript
-		isFinal := result.IsFinal
+		c.mu.Lock()
+		current := c.current == s
+		lastFinalEnd := c.lastFinalEnd
+		if result.IsFinal && ev.End > lastFinalEnd {
+			c.lastFinalEnd = ev.End
+		}
+		c.mu.Unlock()
 
-		if isFinal {
-			// Only trigger agent response on final results
-			fmt.Printf("FINAL: %s %s\n", transcript, time.Now().UTC())
-			c.lastTranscript = transcript
+		if !result.IsFinal {
+			// a rotated out stream only finishes its last utterance
+			if current && ev.End > lastFinalEnd {
+				c.emit(ev)
+			}
+			continue
+		}
 
-			// Only call agent if we have a websocket connection
-			if c.WsConn != nil && c.Sid != "" && c.AgentResponse != nil {
-				// Use the callback function directly
-				c.AgentResponse(true, transcript)
-			} else {
-				log.Println("Cannot trigger agent response - missing websocket or callback")
+		if ev.End <= lastFinalEnd {
+			log.Printf("Google STT dropped a final heard by the previous stream: %q", ev.Text)
+			continue
+		}
+		if s.offset < lastFinalEnd {
+			ev.Text = trimHeard(s.offset, lastFinalEnd, alternative)
+			if ev.Text == "" {
+				continue
 			}
-		} else {
-			// Log interim results without triggering agent response
-			fmt.Printf("Interim: %s %s\n", transcript, time.Now().UTC())
+		}
+		ev.Type = domain.TranscriptFinal
+		c.emit(ev)
+		c.emit(domain.TranscriptEvent{Type: domain.UtteranceEnd, Start: ev.End, End: ev.End})
+	}
+}
+
+// trimHeard drops the words of a final that end before heard, the previous stream already
+// transcribed them
+func trimHeard(offset, heard time.Duration, alternative *speechpb.SpeechRecognitionAlternative) string {
+	if len(alternative.Words) == 0 {
+		return alternative.Transcript
+	}
+	var words []string
+	for _, w := range alternative.Words {
+		if offset+w.EndTime.AsDuration() > heard {
+			words = append(words, w.Word)
 		}
 	}
+	return strings.Join(words, " ")
+}
+
+// emit delivers an event unless the stream was stopped meanwhile
+func (c *GoogleSTTClient) emit(ev domain.TranscriptEvent) {
+	ev.ReceivedAt = time.Now().UTC()
+	select {
+	case c.events <- ev:
+	case <-c.ctx.Done():
+	}
 }
 
 // PushAudioByte provides a Deepgram-like interface for pushing audio
@@ -166,55 +485,3 @@ func (c *GoogleSTTClient) PushAudioByte(data []byte) {
 		log.Println("Audio buffer full, dropping packet")
 	}
 }
-
-func (c *GoogleSTTClient) SendAudioInRealTime() {
-	fmt.Println("SendAudioInRealTime called")
-
-	// Create a buffer to accumulate audio data
-	audioBuffer := make([]byte, 0, 8192) // 8KB initial capacity
-
-	go func() {
-		for {
-			select {
-			case <-c.ctx.Done():
-				fmt.Println("Context cancelled, stopping audio streaming")
-				return
-
-			case receivedData, ok := <-c.DataChan:
-				if !ok {
-					// Channel closed
-					fmt.Println("Data channel closed, stopping audio streaming")
-					return
-				}
-
-				// Add received data to buffer
-				audioBuffer = append(audioBuffer, receivedData...)
-
-				// If we've accumulated enough data, send it
-				// Google recommends 100ms-400ms chunks for better recognition
-				if len(audioBuffer) >= 3200 { // ~200ms of audio at 16kHz
-					err := c.stream.Send(&speechpb.StreamingRecognizeRequest{
-						StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
-							AudioContent: audioBuffer,
-						},
-					})
-
-					if err != nil {
-						log.Printf("Error sending audio to Google: %v", err)
-						if err.Error() == "rpc error: code = Canceled desc = context canceled" {
-							return
-						}
-					}
-
-					// Clear buffer after sending
-					audioBuffer = audioBuffer[:0]
-				}
-
-			// Check for streaming errors with a non-blocking select
-			case err := <-c.errChan:
-				log.Printf("Streaming error: %v", err)
-				return
-			}
-		}
-	}()
-}
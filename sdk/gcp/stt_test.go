@@ -0,0 +1,125 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"twilio-go-stream/domain"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// fakeStream records what is sent, Recv fails once end is closed
+type fakeStream struct {
+	speechpb.Speech_StreamingRecognizeClient
+	sent chan *speechpb.StreamingRecognizeRequest
+	end  chan struct{}
+}
+
+func newFakeStream() *fakeStream {
+	return &fakeStream{sent: make(chan *speechpb.StreamingRecognizeRequest, 16), end: make(chan struct{})}
+}
+
+func (f *fakeStream) Send(req *speechpb.StreamingRecognizeRequest) error {
+	f.sent <- req
+	return nil
+}
+
+func (f *fakeStream) Recv() (*speechpb.StreamingRecognizeResponse, error) {
+	<-f.end
+	return nil, errors.New("stream timed out")
+}
+
+func (f *fakeStream) CloseSend() error { return nil }
+
+func newTestClient(ctx context.Context) *GoogleSTTClient {
+	return &GoogleSTTClient{
+		ctx:      ctx,
+		DataChan: make(chan []byte, 100),
+		events:   make(chan domain.TranscriptEvent, eventBuffer),
+		ended:    make(chan int, 1),
+		cfg:      DefaultSTTConfig(),
+	}
+}
+
+func final(end time.Duration, words map[string]time.Duration, order ...string) *speechpb.StreamingRecognizeResponse {
+	alternative := &speechpb.SpeechRecognitionAlternative{}
+	for i, w := range order {
+		if i > 0 {
+			alternative.Transcript += " "
+		}
+		alternative.Transcript += w
+		alternative.Words = append(alternative.Words, &speechpb.WordInfo{Word: w, EndTime: durationpb.New(words[w])})
+	}
+	return &speechpb.StreamingRecognizeResponse{Results: []*speechpb.StreamingRecognitionResult{{
+		Alternatives:  []*speechpb.SpeechRecognitionAlternative{alternative},
+		IsFinal:       true,
+		ResultEndTime: durationpb.New(end),
+	}}}
+}
+
+func TestFinalsAreDedupedAcrossStreams(t *testing.T) {
+	c := newTestClient(context.Background())
+	old := &recognizeStream{generation: 1}
+	next := &recognizeStream{generation: 2, offset: 3900 * time.Millisecond}
+	c.current = next
+
+	c.processResults(old, final(4200*time.Millisecond, map[string]time.Duration{"book": 3800 * time.Millisecond, "table": 4150 * time.Millisecond}, "book", "table"))
+	// the new stream heard "table" again in the replayed audio
+	c.processResults(next, final(250*time.Millisecond, map[string]time.Duration{"table": 250 * time.Millisecond}, "table"))
+	c.processResults(next, final(time.Second, map[string]time.Duration{
+		"table": 250 * time.Millisecond, "for": 600 * time.Millisecond, "two": 900 * time.Millisecond,
+	}, "table", "for", "two"))
+
+	var finals []string
+	for len(c.events) > 0 {
+		if ev := <-c.events; ev.Type == domain.TranscriptFinal {
+			finals = append(finals, ev.Text)
+		}
+	}
+	if len(finals) != 2 || finals[0] != "book table" || finals[1] != "for two" {
+		t.Fatalf("unexpected finals %q", finals)
+	}
+}
+
+func TestStreamIsReopenedWithReplayWhenItEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newTestClient(ctx)
+	streams := make(chan *fakeStream, 2)
+	c.open = func(ctx context.Context) (speechpb.Speech_StreamingRecognizeClient, error) {
+		s := newFakeStream()
+		streams <- s
+		return s, nil
+	}
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	first := <-streams
+	<-first.sent // config
+	c.PushAudioByte(make([]byte, 3200))
+	if audio := (<-first.sent).GetAudioContent(); len(audio) != 3200 {
+		t.Fatalf("sent %d bytes", len(audio))
+	}
+	close(first.end)
+
+	var second *fakeStream
+	select {
+	case second = <-streams:
+	case <-time.After(time.Second):
+		t.Fatal("stream was not reopened")
+	}
+	if (<-second.sent).GetStreamingConfig() == nil {
+		t.Fatal("the new stream must start with its config")
+	}
+	// 200ms were sent, all of it is within the replay window
+	if audio := (<-second.sent).GetAudioContent(); len(audio) != 3200 {
+		t.Fatalf("replayed %d bytes", len(audio))
+	}
+	if c.Restarts() != 1 {
+		t.Fatalf("expected 1 restart, got %d", c.Restarts())
+	}
+}
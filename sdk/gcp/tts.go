@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"twilio-go-stream/domain"
 
 	texttospeech "cloud.google.com/go/texttospeech/apiv1"
 	"cloud.google.com/go/texttospeech/apiv1/texttospeechpb"
@@ -14,30 +15,98 @@ import (
 
 const maxWorkers = 10
 
+// DefaultVoice is used when the agent does not choose one
+const DefaultVoice = "hi-IN-Chirp3-HD-Aoede"
+
+// TTSConfig configures synthesis, zero values use the defaults
+type TTSConfig struct {
+	Voice          string   `json:"voice"`
+	Language       string   `json:"language"` // empty takes it from the voice, "hi-IN" for "hi-IN-Chirp3-HD-Aoede"
+	SampleRate     int      `json:"sample_rate"`
+	SpeakingRate   float64  `json:"speaking_rate"`   // 0.25 to 4, 0 is the voice's normal rate
+	Pitch          float64  `json:"pitch"`           // semitones, -20 to 20
+	VolumeGainDb   float64  `json:"volume_gain_db"`  // -96 to 16
+	EffectsProfile []string `json:"effects_profile"` // e.g. "telephony-class-application"
+	SSML           bool     `json:"ssml"`            // the LLM may mark up its replies with SSML
+}
+
+// Validate checks the prosody settings are within what Google accepts
+func (cfg TTSConfig) Validate() error {
+	switch {
+	case cfg.SpeakingRate != 0 && (cfg.SpeakingRate < 0.25 || cfg.SpeakingRate > 4):
+		return fmt.Errorf("speaking_rate must be between 0.25 and 4, got %v", cfg.SpeakingRate)
+	case cfg.Pitch < -20 || cfg.Pitch > 20:
+		return fmt.Errorf("pitch must be between -20 and 20 semitones, got %v", cfg.Pitch)
+	case cfg.VolumeGainDb < -96 || cfg.VolumeGainDb > 16:
+		return fmt.Errorf("volume_gain_db must be between -96 and 16, got %v", cfg.VolumeGainDb)
+	}
+	return nil
+}
+
+// DefaultTTSConfig produces 8kHz audio for Twilio
+func DefaultTTSConfig() TTSConfig {
+	return TTSConfig{Voice: DefaultVoice, SampleRate: 8000}
+}
+
+// Instructions tells the LLM it may use SSML when it is enabled
+func (c *GoogleTTSClient) Instructions() string {
+	if !c.cfg.SSML {
+		return ""
+	}
+	return SSMLInstructions
+}
+
 type GoogleTTSClient struct {
 	client   *texttospeech.Client
 	speaking bool
+	cfg      TTSConfig
 }
 
 func (c *GoogleTTSClient) Close() {
 	c.client.Close()
 }
 
-func NewGoogleTTSClient(ctx context.Context) (*GoogleTTSClient, error) {
+// NewGoogleTTSClient creates a TTS client, zero values of cfg use the defaults
+func NewGoogleTTSClient(ctx context.Context, cfg TTSConfig) (*GoogleTTSClient, error) {
+	if cfg.Voice == "" {
+		cfg.Voice = DefaultVoice
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = DefaultTTSConfig().SampleRate
+	}
 	client, err := texttospeech.NewClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TTS client: %v", err)
 	}
-	return &GoogleTTSClient{client: client, speaking: false}, nil
+	return &GoogleTTSClient{client: client, speaking: false, cfg: cfg}, nil
+}
+
+// voiceLanguage returns the language code a voice name starts with, "hi-IN" for "hi-IN-Chirp3-HD-Aoede"
+func voiceLanguage(voice string) string {
+	parts := strings.SplitN(voice, "-", 3)
+	if len(parts) < 2 {
+		return voice
+	}
+	return parts[0] + "-" + parts[1]
 }
 
 // GetSpeech converts text to speech in order
 func (c *GoogleTTSClient) GetSpeech(text string) ([]byte, error) {
 	fmt.Println("Will be speaking:", text)
+	results, err := c.GetSentenceSpeech(splitIntoSentences(text))
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge audio properly with silence between sentences
+	return mergeAudioFiles(results, c.cfg.SampleRate), nil
+}
+
+// GetSentenceSpeech synthesizes each sentence in parallel and returns PCM16 audio per sentence, in order
+func (c *GoogleTTSClient) GetSentenceSpeech(sentences []string) ([][]byte, error) {
 	ctx := context.Background()
 	startTime := time.Now()
 
-	sentences := splitIntoSentences(text)
 	numSentences := len(sentences)
 
 	// Use min(numSentences, maxWorkers) to avoid extra goroutines
@@ -55,7 +124,7 @@ func (c *GoogleTTSClient) GetSpeech(text string) ([]byte, error) {
 			defer wg.Done()
 			for index := range jobs {
 				start := time.Now()
-				audioData := processSentence(ctx, c.client, sentences[index])
+				audioData := processSentence(ctx, c.client, c.cfg, sentences[index])
 				if audioData != nil {
 					results[index] = audioData // Store at correct index
 				}
@@ -72,12 +141,37 @@ func (c *GoogleTTSClient) GetSpeech(text string) ([]byte, error) {
 
 	wg.Wait()
 
-	// Merge audio properly with silence between sentences
-	finalAudio := mergeAudioFiles(results)
-
 	fmt.Printf("Total processing time: %v\n", time.Since(startTime))
 
-	return finalAudio, nil
+	return results, nil
+}
+
+// sentencePause is the silence in seconds played after every synthesized sentence
+const sentencePause = 0.5
+
+// Synthesize speaks text, its PCM16 audio followed by a short pause is sent on the returned channel
+func (c *GoogleTTSClient) Synthesize(ctx context.Context, text string) (<-chan domain.AudioChunk, error) {
+	out := make(chan domain.AudioChunk, 2)
+	go func() {
+		defer close(out)
+		audio := processSentence(ctx, c.client, c.cfg, text)
+		if audio == nil {
+			return
+		}
+		for _, data := range [][]byte{audio, generateSilence(sentencePause, c.cfg.SampleRate)} {
+			select {
+			case out <- domain.AudioChunk{Encoding: domain.AudioPCM16, Data: data}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Stop closes the client
+func (c *GoogleTTSClient) Stop() {
+	c.Close()
 }
 
 func (c *GoogleTTSClient) Speaking(speaking bool) {
@@ -93,28 +187,57 @@ func splitIntoSentences(text string) []string {
 	return sentences
 }
 
-// Processes a sentence using Google Cloud TTS
-func processSentence(ctx context.Context, client *texttospeech.Client, sentence string) []byte {
+// Processes a sentence using Google Cloud TTS. With SSML enabled a sentence with markup is sent
+// as SSML, it is spoken as plain text when the markup is invalid or Google rejects it.
+func processSentence(ctx context.Context, client *texttospeech.Client, cfg TTSConfig, sentence string) []byte {
 	input := &texttospeechpb.SynthesisInput{
 		InputSource: &texttospeechpb.SynthesisInput_Text{Text: sentence},
 	}
+	ssml := false
+	if cfg.SSML && hasMarkup(sentence) {
+		doc, err := ssmlDocument(sentence)
+		if err != nil {
+			log.Printf("Invalid SSML, speaking plain text: %v", err)
+			input.InputSource = &texttospeechpb.SynthesisInput_Text{Text: stripMarkup(sentence)}
+		} else {
+			input.InputSource = &texttospeechpb.SynthesisInput_Ssml{Ssml: doc}
+			ssml = true
+		}
+	}
 
+	language := cfg.Language
+	if language == "" {
+		language = voiceLanguage(cfg.Voice)
+	}
 	voice := &texttospeechpb.VoiceSelectionParams{
-		LanguageCode: "hi-IN",
+		LanguageCode: language,
 		// Name:         "hi-IN-Standard-D",
-		Name: "hi-IN-Chirp3-HD-Aoede",
+		Name: cfg.Voice,
 	}
 
 	audioConfig := &texttospeechpb.AudioConfig{
-		AudioEncoding:   texttospeechpb.AudioEncoding_LINEAR16,
-		SampleRateHertz: 8000,
+		AudioEncoding:    texttospeechpb.AudioEncoding_LINEAR16,
+		SampleRateHertz:  int32(cfg.SampleRate),
+		SpeakingRate:     cfg.SpeakingRate,
+		Pitch:            cfg.Pitch,
+		VolumeGainDb:     cfg.VolumeGainDb,
+		EffectsProfileId: cfg.EffectsProfile,
 	}
 
-	resp, err := client.SynthesizeSpeech(ctx, &texttospeechpb.SynthesizeSpeechRequest{
+	req := &texttospeechpb.SynthesizeSpeechRequest{
 		Input:       input,
 		Voice:       voice,
 		AudioConfig: audioConfig,
-	})
+	}
+	resp, err := client.SynthesizeSpeech(ctx, req)
+	if err != nil && ssml && ctx.Err() == nil {
+		// some voices do not support SSML or some of its tags
+		log.Printf("SSML rejected, speaking plain text: %v", err)
+		req.Input = &texttospeechpb.SynthesisInput{
+			InputSource: &texttospeechpb.SynthesisInput_Text{Text: stripMarkup(sentence)},
+		}
+		resp, err = client.SynthesizeSpeech(ctx, req)
+	}
 	if err != nil {
 		log.Printf("Error synthesizing speech: %v", err)
 		return nil
@@ -124,7 +247,7 @@ func processSentence(ctx context.Context, client *texttospeech.Client, sentence
 }
 
 // Merges audio files in correct order with silence between sentences
-func mergeAudioFiles(results [][]byte) []byte {
+func mergeAudioFiles(results [][]byte, sampleRate int) []byte {
 	var finalAudio []byte
 
 	// 0.5 seconds of silence buffer (adjust as needed)
@@ -133,7 +256,7 @@ func mergeAudioFiles(results [][]byte) []byte {
 	for _, audioData := range results {
 		if audioData != nil {
 			finalAudio = append(finalAudio, audioData...)
-			finalAudio = append(finalAudio, generateSilence(0.5, 8000)...) // Add silence between sentences
+			finalAudio = append(finalAudio, generateSilence(sentencePause, sampleRate)...) // Add silence between sentences
 		}
 	}
 
@@ -0,0 +1,147 @@
+package language_processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"twilio-go-stream/domain"
+)
+
+// fakeLLM stands in for an OpenAI compatible server
+func fakeLLM(t *testing.T, reply []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "test-model" {
+			t.Errorf("unexpected model %q", req.Model)
+		}
+
+		if !req.Stream {
+			fmt.Fprintf(w, `{"id":"1","object":"chat.completion","model":"test-model","choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}]}`, strings.Join(reply, ""))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range reply {
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"test-model\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q},\"finish_reason\":null}]}\n\n", delta)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func prompt() *domain.Prompt {
+	p := domain.InitPrompt()
+	p.PushMessage("user", "hi")
+	return p
+}
+
+func TestBackendsAgainstStandIn(t *testing.T) {
+	server := fakeLLM(t, []string{"Hello", " there."})
+	defer server.Close()
+
+	backends := map[string]Config{
+		ProviderOpenAICompatible: {Provider: ProviderOpenAICompatible, BaseURL: server.URL + "/v1", APIKey: "key", Model: "test-model"},
+		ProviderGroq:             {Provider: ProviderGroq, BaseURL: server.URL + "/v1", APIKey: "key", Model: "test-model"},
+		ProviderOpenAI:           {Provider: ProviderOpenAI, BaseURL: server.URL + "/v1", APIKey: "key", Model: "test-model"},
+	}
+	for name, cfg := range backends {
+		t.Run(name, func(t *testing.T) {
+			backend, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := backend.Chat(context.Background(), prompt())
+			if err != nil || msg.Content != "Hello there." {
+				t.Fatalf("Chat returned %q, %v", msg.Content, err)
+			}
+
+			var deltas []string
+			msg, err = backend.ChatStream(context.Background(), prompt(), func(d string) { deltas = append(deltas, d) })
+			if err != nil || msg.Content != "Hello there." || len(deltas) != 2 {
+				t.Fatalf("ChatStream returned %q %q, %v", msg.Content, deltas, err)
+			}
+		})
+	}
+}
+
+func TestChatStreamCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	backend := NewOpenAICompatible(server.URL, "key", "test-model")
+	if _, err := backend.ChatStream(ctx, prompt(), func(string) {}); err == nil {
+		t.Fatal("expected cancelled request to fail")
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	if _, err := New(Config{Provider: "nope"}); err == nil {
+		t.Fatal("unknown provider accepted")
+	}
+	if _, err := New(Config{Provider: ProviderOpenAICompatible}); err == nil {
+		t.Fatal("openai-compatible without base URL accepted")
+	}
+}
+
+func TestChatStreamToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req domain.Prompt
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Tools) != 1 || req.Tools[0].Function.Name != "hang_up" {
+			t.Errorf("tools not sent: %+v", req.Tools)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Bye."}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"hang_up","arguments":""}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"reason\":"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"done\"}"}}]}}]}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := prompt()
+	p.Tools = []domain.Tool{{Type: "function", Function: domain.ToolFunction{Name: "hang_up", Parameters: json.RawMessage(`{"type":"object"}`)}}}
+	for _, provider := range []string{ProviderOpenAICompatible, ProviderOpenAI} {
+		backend, _ := New(Config{Provider: provider, BaseURL: server.URL, APIKey: "key", Model: "test-model"})
+		msg, err := backend.ChatStream(context.Background(), p, func(string) {})
+		if err != nil {
+			t.Fatal(provider, err)
+		}
+		if msg.Content != "Bye." || len(msg.ToolCalls) != 1 {
+			t.Fatalf("%s returned %+v", provider, msg)
+		}
+		call := msg.ToolCalls[0]
+		if call.ID != "call_1" || call.Function.Name != "hang_up" || call.Function.Arguments != `{"reason":"done"}` || call.Index != nil {
+			t.Fatalf("%s merged tool call %+v", provider, call)
+		}
+	}
+}
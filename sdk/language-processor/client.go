@@ -1,13 +1,9 @@
 package language_processor
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-	"strings"
-	"time"
 	"twilio-go-stream/domain"
 )
 
@@ -27,50 +23,93 @@ func Must(URL, UserID, SessionID, AgentID string) *Client {
 	return c
 }
 
-//write me function that will go get req to
-
-func GetChatResponse(sessionID, prompt string) (string, error) {
-	resp, err := ChatWithHistory(sessionID, prompt)
-	return resp, err
+// Backend is a chat completion provider, the conversation history is owned by the caller
+type Backend interface {
+	// Chat returns the complete reply
+	Chat(ctx context.Context, prompt *domain.Prompt) (domain.Message, error)
+	// ChatStream streams the reply, onDelta receives text as it is generated
+	ChatStream(ctx context.Context, prompt *domain.Prompt, onDelta func(string)) (domain.Message, error)
 }
 
-func GetChatResponseFromGroq(prompt *domain.Prompt) string {
-	start := time.Now().UTC()
-	url := "https://api.groq.com/openai/v1/chat/completions"
-	method := "POST"
-
-	// Convert struct to JSON
-	jsonData, err := json.MarshalIndent(prompt, "", "  ")
-	if err != nil {
-		fmt.Println("Error:", err)
-		return ""
-	}
-	reader := strings.NewReader(string(jsonData))
-	// fmt.Println(string(jsonData))
+// Supported providers
+const (
+	ProviderGroq             = "groq"
+	ProviderOpenAI           = "openai"
+	ProviderOpenAICompatible = "openai-compatible"
+)
 
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, reader)
+// Config selects and configures a Backend
+type Config struct {
+	Provider string `json:"provider"`
+	BaseURL  string `json:"base_url"` // required for openai-compatible, optional override for the others
+	APIKey   string `json:"api_key"`
+	Model    string `json:"model"` // default model, an agent's own model takes precedence
+}
 
-	if err != nil {
-		fmt.Println(err)
-		return ""
+// Validate reports settings New would reject or that fail on the first request
+func (cfg Config) Validate() error {
+	switch cfg.Provider {
+	case ProviderGroq, ProviderOpenAI, "":
+		if cfg.APIKey == "" {
+			return fmt.Errorf("%s provider needs an API key", cfg.provider())
+		}
+	case ProviderOpenAICompatible:
+		if cfg.BaseURL == "" {
+			return fmt.Errorf("%s provider needs a base URL", ProviderOpenAICompatible)
+		}
+	default:
+		return fmt.Errorf("unknown LLM provider %q (want %s, %s or %s)", cfg.Provider, ProviderGroq, ProviderOpenAI, ProviderOpenAICompatible)
 	}
-	req.Header.Add("Content-Type", "application/json")
+	return nil
+}
 
-	req.Header.Add("Authorization", "Bearer "+os.Getenv("GROQ_API_KEY"))
+func (cfg Config) provider() string {
+	if cfg.Provider == "" {
+		return ProviderGroq
+	}
+	return cfg.Provider
+}
 
-	res, err := client.Do(req)
-	if err != nil {
-		fmt.Println(err)
-		return ""
+// New creates the backend selected by cfg
+func New(cfg Config) (Backend, error) {
+	switch cfg.Provider {
+	case ProviderGroq, "":
+		b := NewGroq(cfg.APIKey, cfg.Model)
+		if cfg.BaseURL != "" {
+			b.BaseURL = cfg.BaseURL
+		}
+		return b, nil
+	case ProviderOpenAI:
+		return NewOpenAI(cfg.APIKey, cfg.Model, cfg.BaseURL), nil
+	case ProviderOpenAICompatible:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("%s provider needs a base URL", ProviderOpenAICompatible)
+		}
+		return NewOpenAICompatible(cfg.BaseURL, cfg.APIKey, cfg.Model), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.Provider)
 	}
-	defer res.Body.Close()
+}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		fmt.Println(err)
-		return ""
+// ConfigFromEnv reads LLM_PROVIDER, LLM_BASE_URL, LLM_API_KEY and LLM_MODEL,
+// the API key falls back to GROQ_API_KEY or OPENAI_API_KEY depending on the provider
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Provider: os.Getenv("LLM_PROVIDER"),
+		BaseURL:  os.Getenv("LLM_BASE_URL"),
+		APIKey:   os.Getenv("LLM_API_KEY"),
+		Model:    os.Getenv("LLM_MODEL"),
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = ProviderGroq
+	}
+	if cfg.APIKey == "" {
+		switch cfg.Provider {
+		case ProviderGroq:
+			cfg.APIKey = os.Getenv("GROQ_API_KEY")
+		case ProviderOpenAI:
+			cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+		}
 	}
-	fmt.Println("Grok took", time.Now().UTC().Sub(start), "ms")
-	return string(body)
+	return cfg
 }
@@ -0,0 +1,188 @@
+package language_processor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"twilio-go-stream/domain"
+)
+
+const groqBaseURL = "https://api.groq.com/openai/v1"
+
+const defaultGroqModel = "llama-3.3-70b-versatile"
+
+// OpenAICompatible talks to any server exposing the OpenAI /chat/completions API,
+// Groq, vLLM, Ollama and llama.cpp all do
+type OpenAICompatible struct {
+	BaseURL    string
+	APIKey     string
+	Model      string // used when the prompt does not name a model
+	HTTPClient *http.Client
+}
+
+func NewOpenAICompatible(baseURL, apiKey, model string) *OpenAICompatible {
+	return &OpenAICompatible{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		HTTPClient: &http.Client{},
+	}
+}
+
+// NewGroq creates a backend for Groq's OpenAI compatible endpoint
+func NewGroq(apiKey, model string) *OpenAICompatible {
+	if model == "" {
+		model = defaultGroqModel
+	}
+	return NewOpenAICompatible(groqBaseURL, apiKey, model)
+}
+
+// Chat returns the complete reply
+func (c *OpenAICompatible) Chat(ctx context.Context, prompt *domain.Prompt) (domain.Message, error) {
+	start := time.Now().UTC()
+	res, err := c.post(ctx, prompt, false)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	defer res.Body.Close()
+
+	msg := domain.ChatCompletion{}
+	if err := json.NewDecoder(res.Body).Decode(&msg); err != nil {
+		return domain.Message{}, fmt.Errorf("decoding completion: %w", err)
+	}
+	fmt.Println("LLM took", time.Now().UTC().Sub(start))
+	if len(msg.Choices) == 0 {
+		return domain.Message{}, fmt.Errorf("completion has no choices")
+	}
+	return msg.Choices[0].Message, nil
+}
+
+// ChatStream requests a streamed completion, onDelta receives text as it is generated.
+// The full reply is returned once the stream ends, cancelling ctx aborts the request.
+func (c *OpenAICompatible) ChatStream(ctx context.Context, prompt *domain.Prompt, onDelta func(string)) (domain.Message, error) {
+	start := time.Now().UTC()
+	res, err := c.post(ctx, prompt, true)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	defer res.Body.Close()
+
+	first := true
+	reply, err := readChatStream(res.Body, func(delta string) {
+		if first {
+			fmt.Println("LLM first token after", time.Now().UTC().Sub(start))
+			first = false
+		}
+		onDelta(delta)
+	})
+	fmt.Println("LLM stream took", time.Now().UTC().Sub(start))
+	return reply, err
+}
+
+// post sends the prompt to /chat/completions and checks the status
+func (c *OpenAICompatible) post(ctx context.Context, prompt *domain.Prompt, stream bool) (*http.Response, error) {
+	req := prompt.Clone()
+	req.Stream = stream
+	if req.Model == "" {
+		req.Model = c.Model
+	}
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/chat/completions", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Add("Content-Type", "application/json")
+	if stream {
+		httpReq.Header.Add("Accept", "text/event-stream")
+	}
+	if c.APIKey != "" {
+		httpReq.Header.Add("Authorization", "Bearer "+c.APIKey)
+	}
+
+	res, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("%s returned %s: %s", c.BaseURL, res.Status, strings.TrimSpace(string(body)))
+	}
+	return res, nil
+}
+
+// readChatStream parses OpenAI style server-sent events until [DONE], text deltas go to onDelta
+// and tool call fragments are merged into the returned message
+func readChatStream(r io.Reader, onDelta func(string)) (domain.Message, error) {
+	var sb strings.Builder
+	var calls []domain.ToolCall
+	reply := func() domain.Message {
+		return domain.Message{Role: "assistant", Content: sb.String(), ToolCalls: calls}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue // blank separators and SSE comments
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk domain.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return reply(), fmt.Errorf("decoding stream chunk: %w", err)
+		}
+		for _, choice := range chunk.Choices {
+			for _, delta := range choice.Delta.ToolCalls {
+				calls = mergeToolCall(calls, delta)
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			sb.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+	}
+	return reply(), scanner.Err()
+}
+
+// mergeToolCall adds a streamed tool call fragment, the id and name come in the first
+// fragment of each call and the arguments are split across the following ones
+func mergeToolCall(calls []domain.ToolCall, delta domain.ToolCall) []domain.ToolCall {
+	index := len(calls)
+	if delta.Index != nil {
+		index = *delta.Index
+	} else if delta.ID == "" && len(calls) > 0 {
+		index = len(calls) - 1
+	}
+	for len(calls) <= index {
+		calls = append(calls, domain.ToolCall{Type: "function"})
+	}
+
+	call := &calls[index]
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+	if delta.Type != "" {
+		call.Type = delta.Type
+	}
+	if delta.Function.Name != "" {
+		call.Function.Name = delta.Function.Name
+	}
+	call.Function.Arguments += delta.Function.Arguments
+	return calls
+}
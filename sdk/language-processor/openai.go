@@ -0,0 +1,143 @@
+package language_processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"twilio-go-stream/domain"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const defaultOpenAIModel = openai.GPT4o
+
+// OpenAI uses the official API through the go-openai SDK
+type OpenAI struct {
+	client *openai.Client
+	Model  string
+}
+
+// NewOpenAI creates an OpenAI backend, baseURL is optional (e.g. an Azure or proxy endpoint)
+func NewOpenAI(apiKey, model, baseURL string) *OpenAI {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	return &OpenAI{client: openai.NewClientWithConfig(config), Model: model}
+}
+
+// Chat returns the complete reply
+func (c *OpenAI) Chat(ctx context.Context, prompt *domain.Prompt) (domain.Message, error) {
+	start := time.Now().UTC()
+	resp, err := c.client.CreateChatCompletion(ctx, c.request(prompt))
+	if err != nil {
+		return domain.Message{}, err
+	}
+	fmt.Println("OpenAI took", time.Now().UTC().Sub(start))
+	if len(resp.Choices) == 0 {
+		return domain.Message{}, fmt.Errorf("completion has no choices")
+	}
+	msg := resp.Choices[0].Message
+	return domain.Message{Role: msg.Role, Content: msg.Content, ToolCalls: fromSDKToolCalls(msg.ToolCalls)}, nil
+}
+
+// ChatStream streams the reply, onDelta receives text as it is generated
+func (c *OpenAI) ChatStream(ctx context.Context, prompt *domain.Prompt, onDelta func(string)) (domain.Message, error) {
+	start := time.Now().UTC()
+	req := c.request(prompt)
+	req.Stream = true
+
+	stream, err := c.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	defer stream.Close()
+
+	var sb strings.Builder
+	var calls []domain.ToolCall
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return domain.Message{Role: openai.ChatMessageRoleAssistant, Content: sb.String(), ToolCalls: calls}, err
+		}
+		for _, choice := range resp.Choices {
+			for _, delta := range fromSDKToolCalls(choice.Delta.ToolCalls) {
+				calls = mergeToolCall(calls, delta)
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if sb.Len() == 0 {
+				fmt.Println("OpenAI first token after", time.Now().UTC().Sub(start))
+			}
+			sb.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+	}
+	return domain.Message{Role: openai.ChatMessageRoleAssistant, Content: sb.String(), ToolCalls: calls}, nil
+}
+
+// request converts the prompt to the SDK types
+func (c *OpenAI) request(prompt *domain.Prompt) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, 0, len(prompt.Messages))
+	for _, m := range prompt.Messages {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			Name:       m.Name,
+			ToolCalls:  toSDKToolCalls(m.ToolCalls),
+			ToolCallID: m.ToolCallID,
+		})
+	}
+
+	var tools []openai.Tool
+	for _, t := range prompt.Tools {
+		tools = append(tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  t.Function.Parameters,
+			},
+		})
+	}
+	model := prompt.Model
+	if model == "" {
+		model = c.Model
+	}
+	return openai.ChatCompletionRequest{Model: model, Messages: messages, Tools: tools}
+}
+
+func toSDKToolCalls(calls []domain.ToolCall) []openai.ToolCall {
+	var out []openai.ToolCall
+	for _, call := range calls {
+		out = append(out, openai.ToolCall{
+			ID:       call.ID,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: call.Function.Name, Arguments: call.Function.Arguments},
+		})
+	}
+	return out
+}
+
+func fromSDKToolCalls(calls []openai.ToolCall) []domain.ToolCall {
+	var out []domain.ToolCall
+	for _, call := range calls {
+		out = append(out, domain.ToolCall{
+			Index:    call.Index,
+			ID:       call.ID,
+			Type:     string(call.Type),
+			Function: domain.FunctionCall{Name: call.Function.Name, Arguments: call.Function.Arguments},
+		})
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package twilio
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Call statuses reported by Twilio
+const (
+	CallQueued     = "queued"
+	CallRinging    = "ringing"
+	CallInProgress = "in-progress"
+	CallCompleted  = "completed"
+	CallBusy       = "busy"
+	CallFailed     = "failed"
+	CallNoAnswer   = "no-answer"
+	CallCanceled   = "canceled"
+)
+
+// Call is a call resource of the REST API
+type Call struct {
+	Sid           string `json:"sid"`
+	AccountSid    string `json:"account_sid"`
+	ParentCallSid string `json:"parent_call_sid"`
+	To            string `json:"to"`
+	From          string `json:"from"`
+	Status        string `json:"status"`
+	Direction     string `json:"direction"`
+	Duration      string `json:"duration"` // seconds, empty until the call ends
+	StartTime     string `json:"start_time"`
+	EndTime       string `json:"end_time"`
+	AnsweredBy    string `json:"answered_by"`
+}
+
+// CallParams are the options of an outbound call, either URL or Twiml says what to do once answered
+type CallParams struct {
+	To             string
+	From           string
+	URL            string
+	Twiml          string
+	StatusCallback string
+	Timeout        int  // seconds to let the phone ring
+	Record         bool // record the whole call
+}
+
+// CreateCall starts an outbound call
+func (c *Client) CreateCall(ctx context.Context, params CallParams) (*Call, error) {
+	form := url.Values{"To": {params.To}, "From": {params.From}}
+	if params.URL != "" {
+		form.Set("Url", params.URL)
+	}
+	if params.Twiml != "" {
+		form.Set("Twiml", params.Twiml)
+	}
+	if params.StatusCallback != "" {
+		form.Set("StatusCallback", params.StatusCallback)
+	}
+	if params.Timeout > 0 {
+		form.Set("Timeout", strconv.Itoa(params.Timeout))
+	}
+	if params.Record {
+		form.Set("Record", "true")
+	}
+
+	call := &Call{}
+	err := c.do(ctx, request{method: http.MethodPost, path: "/Calls.json", form: form}, call)
+	if err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// FetchCall returns the current state of a call
+func (c *Client) FetchCall(ctx context.Context, callSid string) (*Call, error) {
+	call := &Call{}
+	err := c.do(ctx, request{method: http.MethodGet, path: "/Calls/" + callSid + ".json", idempotent: true}, call)
+	if err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// UpdateCall replaces the TwiML of a live call, Twilio stops the media stream and runs the new TwiML
+func (c *Client) UpdateCall(ctx context.Context, callSid, twiml string) error {
+	return c.updateCall(ctx, callSid, url.Values{"Twiml": {twiml}})
+}
+
+// RedirectCall makes a live call fetch its TwiML from twimlURL
+func (c *Client) RedirectCall(ctx context.Context, callSid, twimlURL string) error {
+	return c.updateCall(ctx, callSid, url.Values{"Url": {twimlURL}, "Method": {http.MethodPost}})
+}
+
+// EndCall hangs up a live call
+func (c *Client) EndCall(ctx context.Context, callSid string) error {
+	return c.updateCall(ctx, callSid, url.Values{"Status": {CallCompleted}})
+}
+
+// updateCall is idempotent, sending the same TwiML or status twice has the same effect
+func (c *Client) updateCall(ctx context.Context, callSid string, form url.Values) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/Calls/" + callSid + ".json", form: form, idempotent: true}, nil)
+}
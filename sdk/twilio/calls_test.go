@@ -0,0 +1,36 @@
+package twilio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEndCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "AC123" || pass != "token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/2010-04-01/Accounts/AC123/Calls/CA1.json" || r.FormValue("Status") != "completed" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Form)
+		}
+		w.Write([]byte(`{"sid":"CA1","status":"completed"}`))
+	}))
+	defer server.Close()
+
+	c := Must(server.URL, "", "token", "mulaw", "", 8000)
+	if err := c.EndCall(context.Background(), "CA1"); err == nil {
+		t.Fatal("expected an error without an account sid")
+	}
+	c.AccountSid = "AC123"
+	if err := c.EndCall(context.Background(), "CA1"); err != nil {
+		t.Fatal(err)
+	}
+	c.Secret = "wrong"
+	if err := c.EndCall(context.Background(), "CA1"); err == nil {
+		t.Fatal("expected a 401 to be reported")
+	}
+}
@@ -1,12 +1,22 @@
 package twilio
 
+import (
+	"net/http"
+	"time"
+)
+
 type Client struct {
-	TwilioURL  string
+	TwilioURL  string // REST API base URL, https://api.twilio.com or a fake in tests
 	WebHookURL string
-	Secret     string
+	AccountSid string // needed for REST calls
+	Secret     string // auth token, signs webhooks and authenticates REST calls
 	Frequency  int
 	AudioCodec string
 	Greeting   string
+
+	HTTPClient   *http.Client
+	MaxRetries   int           // retries of temporary REST failures, DefaultMaxRetries when 0, NoRetries turns them off
+	RetryBackoff time.Duration // first retry delay, doubled after every attempt
 }
 
 func Must(TwilioURL, WebHookURL, Secret, AudioCodec, Greeting string, Frequency int) *Client {
@@ -19,3 +29,8 @@ func Must(TwilioURL, WebHookURL, Secret, AudioCodec, Greeting string, Frequency
 	c.Greeting = Greeting
 	return c
 }
+
+// New creates a REST client for the account, baseURL is usually https://api.twilio.com
+func New(baseURL, accountSid, authToken string) *Client {
+	return &Client{TwilioURL: baseURL, AccountSid: accountSid, Secret: authToken}
+}
@@ -0,0 +1,27 @@
+package twilio
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Message is an SMS resource of the REST API
+type Message struct {
+	Sid    string `json:"sid"`
+	To     string `json:"to"`
+	From   string `json:"from"`
+	Body   string `json:"body"`
+	Status string `json:"status"`
+}
+
+// SendSMS sends a text message, e.g. a confirmation to the caller during or after a call
+func (c *Client) SendSMS(ctx context.Context, from, to, body string) (*Message, error) {
+	msg := &Message{}
+	form := url.Values{"From": {from}, "To": {to}, "Body": {body}}
+	err := c.do(ctx, request{method: http.MethodPost, path: "/Messages.json", form: form}, msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
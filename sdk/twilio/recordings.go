@@ -0,0 +1,56 @@
+package twilio
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Recording is a call recording resource of the REST API
+type Recording struct {
+	Sid      string `json:"sid"`
+	CallSid  string `json:"call_sid"`
+	Status   string `json:"status"` // in-progress, paused, stopped, processing, completed
+	Channels int    `json:"channels"`
+	Duration string `json:"duration"`
+	URI      string `json:"uri"`
+}
+
+// RecordingParams are the options of a recording started on a live call
+type RecordingParams struct {
+	Channels       string // "mono" or "dual", dual keeps the caller and the agent apart
+	StatusCallback string
+}
+
+// StartRecording starts recording a live call
+func (c *Client) StartRecording(ctx context.Context, callSid string, params RecordingParams) (*Recording, error) {
+	form := url.Values{}
+	if params.Channels != "" {
+		form.Set("RecordingChannels", params.Channels)
+	}
+	if params.StatusCallback != "" {
+		form.Set("RecordingStatusCallback", params.StatusCallback)
+	}
+
+	recording := &Recording{}
+	err := c.do(ctx, request{method: http.MethodPost, path: "/Calls/" + callSid + "/Recordings.json", form: form}, recording)
+	if err != nil {
+		return nil, err
+	}
+	return recording, nil
+}
+
+// StopRecording stops a recording started with StartRecording
+func (c *Client) StopRecording(ctx context.Context, callSid, recordingSid string) (*Recording, error) {
+	recording := &Recording{}
+	err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/Calls/" + callSid + "/Recordings/" + recordingSid + ".json",
+		form:       url.Values{"Status": {"stopped"}},
+		idempotent: true,
+	}, recording)
+	if err != nil {
+		return nil, err
+	}
+	return recording, nil
+}
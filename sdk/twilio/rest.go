@@ -0,0 +1,152 @@
+package twilio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const apiVersion = "2010-04-01"
+
+// Defaults used when the Client fields are left empty
+const (
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = 250 * time.Millisecond
+)
+
+// NoRetries as MaxRetries makes every request a single attempt, e.g. for a client that sends messages
+const NoRetries = -1
+
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// ErrMissingCredentials is returned when AccountSid or the auth token is not set
+var ErrMissingCredentials = errors.New("twilio account sid and auth token are required for the REST API")
+
+// Error is an error response of the Twilio REST API, Code is Twilio's error code
+// (https://www.twilio.com/docs/api/errors) and Status the HTTP status
+type Error struct {
+	Status   int    `json:"status"`
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	MoreInfo string `json:"more_info"`
+}
+
+func (e *Error) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("twilio: %d %s (code %d)", e.Status, e.Message, e.Code)
+	}
+	return fmt.Sprintf("twilio: %d %s", e.Status, e.Message)
+}
+
+// Temporary reports whether the request may succeed if it is sent again
+func (e *Error) Temporary() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// IsNotFound reports whether err is a 404 from Twilio, e.g. a call sid that does not exist
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// request is a call to the REST API. Requests that are not idempotent (creating a call or
+// sending an SMS) are only retried when Twilio rejected them with 429, never after a 5xx
+// or a network error as they may already have been carried out.
+type request struct {
+	method     string
+	path       string // relative to /2010-04-01/Accounts/{AccountSid}
+	form       url.Values
+	idempotent bool
+}
+
+// do sends the request, retrying temporary failures with exponential backoff, and decodes
+// the JSON response into out
+func (c *Client) do(ctx context.Context, req request, out interface{}) error {
+	if c.AccountSid == "" || c.Secret == "" {
+		return ErrMissingCredentials
+	}
+
+	maxRetries := c.MaxRetries
+	switch {
+	case maxRetries == 0:
+		maxRetries = DefaultMaxRetries
+	case maxRetries < 0:
+		maxRetries = 0
+	}
+	backoff := c.RetryBackoff
+	if backoff == 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = c.send(ctx, req, out)
+		if err == nil || !retry || attempt >= maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff << attempt):
+		}
+	}
+}
+
+// send makes a single attempt and reports whether a failure can be retried
+func (c *Client) send(ctx context.Context, req request, out interface{}) (bool, error) {
+	endpoint := fmt.Sprintf("%s/%s/Accounts/%s%s", strings.TrimRight(c.TwilioURL, "/"), apiVersion, c.AccountSid, req.path)
+	var body io.Reader
+	if req.form != nil {
+		body = strings.NewReader(req.form.Encode())
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, endpoint, body)
+	if err != nil {
+		return false, err
+	}
+	if req.form != nil {
+		httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.SetBasicAuth(c.AccountSid, c.Secret)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = defaultHTTPClient
+	}
+	res, err := httpClient.Do(httpReq)
+	if err != nil {
+		return req.idempotent && ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return req.idempotent, err
+	}
+
+	if res.StatusCode >= 300 {
+		apiErr := &Error{}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		apiErr.Status = res.StatusCode
+		retry := res.StatusCode == http.StatusTooManyRequests || (req.idempotent && apiErr.Temporary())
+		return retry, apiErr
+	}
+
+	if out == nil || len(data) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return false, fmt.Errorf("twilio: decoding response: %w", err)
+	}
+	return false, nil
+}
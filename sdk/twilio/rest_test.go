@@ -0,0 +1,170 @@
+package twilio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTwilio is a minimal stand-in for the REST API of account AC123
+type fakeTwilio struct {
+	mu       sync.Mutex
+	calls    map[string]*Call
+	requests []string
+	failures []int // statuses returned before requests are served
+}
+
+func newFakeTwilio(t *testing.T) (*fakeTwilio, *Client) {
+	f := &fakeTwilio{calls: map[string]*Call{"CA1": {Sid: "CA1", Status: CallInProgress}}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	c := New(server.URL, "AC123", "token")
+	c.RetryBackoff = time.Millisecond
+	return f, c
+}
+
+func (f *fakeTwilio) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.ParseForm()
+	path := strings.TrimPrefix(r.URL.Path, "/2010-04-01/Accounts/AC123")
+	f.requests = append(f.requests, r.Method+" "+path)
+
+	if user, pass, _ := r.BasicAuth(); user != "AC123" || pass != "token" {
+		writeError(w, http.StatusUnauthorized, 20003, "Authenticate")
+		return
+	}
+	if len(f.failures) > 0 {
+		status := f.failures[0]
+		f.failures = f.failures[1:]
+		writeError(w, status, 0, "try again")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && path == "/Calls.json":
+		call := &Call{Sid: "CA2", To: r.FormValue("To"), From: r.FormValue("From"), Status: CallQueued}
+		f.calls[call.Sid] = call
+		json.NewEncoder(w).Encode(call)
+	case r.Method == http.MethodPost && path == "/Messages.json":
+		json.NewEncoder(w).Encode(Message{Sid: "SM1", To: r.FormValue("To"), From: r.FormValue("From"), Body: r.FormValue("Body"), Status: "queued"})
+	case strings.HasSuffix(path, "/Recordings.json"):
+		json.NewEncoder(w).Encode(Recording{Sid: "RE1", CallSid: "CA1", Status: "in-progress", Channels: 2})
+	case strings.HasPrefix(path, "/Calls/CA1/Recordings/"):
+		json.NewEncoder(w).Encode(Recording{Sid: "RE1", CallSid: "CA1", Status: r.FormValue("Status")})
+	case strings.HasPrefix(path, "/Calls/"):
+		call, ok := f.calls[strings.TrimSuffix(strings.TrimPrefix(path, "/Calls/"), ".json")]
+		if !ok {
+			writeError(w, http.StatusNotFound, 20404, "The requested resource was not found")
+			return
+		}
+		if status := r.FormValue("Status"); status != "" {
+			call.Status = status
+		}
+		json.NewEncoder(w).Encode(call)
+	default:
+		writeError(w, http.StatusNotFound, 20404, "The requested resource was not found")
+	}
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Error{Status: status, Code: code, Message: message})
+}
+
+func TestCallLifecycle(t *testing.T) {
+	_, c := newFakeTwilio(t)
+	ctx := context.Background()
+
+	call, err := c.CreateCall(ctx, CallParams{To: "+15550001", From: "+15550002", URL: "https://example.com/incoming-call"})
+	if err != nil || call.Sid != "CA2" || call.To != "+15550001" || call.Status != CallQueued {
+		t.Fatalf("CreateCall returned %+v, %v", call, err)
+	}
+
+	if err := c.EndCall(ctx, "CA2"); err != nil {
+		t.Fatal(err)
+	}
+	call, err = c.FetchCall(ctx, "CA2")
+	if err != nil || call.Status != CallCompleted {
+		t.Fatalf("FetchCall returned %+v, %v", call, err)
+	}
+
+	_, err = c.FetchCall(ctx, "CA404")
+	var apiErr *Error
+	if !IsNotFound(err) || !errors.As(err, &apiErr) || apiErr.Code != 20404 {
+		t.Fatalf("expected a typed 404, got %v", err)
+	}
+}
+
+func TestRecordingsAndSMS(t *testing.T) {
+	_, c := newFakeTwilio(t)
+	ctx := context.Background()
+
+	recording, err := c.StartRecording(ctx, "CA1", RecordingParams{Channels: "dual"})
+	if err != nil || recording.Sid != "RE1" || recording.Status != "in-progress" {
+		t.Fatalf("StartRecording returned %+v, %v", recording, err)
+	}
+	recording, err = c.StopRecording(ctx, "CA1", "RE1")
+	if err != nil || recording.Status != "stopped" {
+		t.Fatalf("StopRecording returned %+v, %v", recording, err)
+	}
+
+	msg, err := c.SendSMS(ctx, "+15550002", "+15550001", "Your booking is confirmed")
+	if err != nil || msg.Sid != "SM1" || msg.Body != "Your booking is confirmed" {
+		t.Fatalf("SendSMS returned %+v, %v", msg, err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	f, c := newFakeTwilio(t)
+	ctx := context.Background()
+
+	// idempotent requests are retried on 5xx
+	f.failures = []int{http.StatusServiceUnavailable, http.StatusInternalServerError}
+	if _, err := c.FetchCall(ctx, "CA1"); err != nil {
+		t.Fatalf("FetchCall was not retried: %v", err)
+	}
+
+	// creating a call is only retried when it was rate limited
+	f.failures = []int{http.StatusTooManyRequests}
+	if _, err := c.CreateCall(ctx, CallParams{To: "+15550001", From: "+15550002", Twiml: "<Response/>"}); err != nil {
+		t.Fatalf("rate limited CreateCall was not retried: %v", err)
+	}
+	f.failures = []int{http.StatusInternalServerError}
+	f.requests = nil
+	_, err := c.CreateCall(ctx, CallParams{To: "+15550001", From: "+15550002", Twiml: "<Response/>"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusInternalServerError || len(f.requests) != 1 {
+		t.Fatalf("CreateCall retried after a 500: %v, %v", err, f.requests)
+	}
+
+	// retries give up after MaxRetries
+	c.MaxRetries = 2
+	f.failures = []int{503, 503, 503, 503}
+	f.requests = nil
+	if _, err := c.FetchCall(ctx, "CA1"); err == nil || len(f.requests) != 3 {
+		t.Fatalf("expected 3 attempts, got %d: %v", len(f.requests), err)
+	}
+
+	// and are turned off with NoRetries
+	c.MaxRetries = NoRetries
+	f.failures = []int{503, 503}
+	f.requests = nil
+	if _, err := c.FetchCall(ctx, "CA1"); err == nil || len(f.requests) != 1 {
+		t.Fatalf("expected a single attempt, got %d: %v", len(f.requests), err)
+	}
+}
+
+func TestMissingCredentials(t *testing.T) {
+	c := New("http://127.0.0.1:0", "", "")
+	if _, err := c.FetchCall(context.Background(), "CA1"); !errors.Is(err, ErrMissingCredentials) {
+		t.Fatalf("expected ErrMissingCredentials, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package twilio
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SignatureHeader is the header Twilio uses to sign webhook and WebSocket requests
+const SignatureHeader = "X-Twilio-Signature"
+
+// ComputeSignature returns the signature Twilio sends for a request to rawURL
+// carrying the given POST params: base64(HMAC-SHA1(authToken, url + sorted key/values))
+func ComputeSignature(authToken, rawURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(rawURL)
+	for _, k := range keys {
+		values := append([]string(nil), params[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			sb.WriteString(k)
+			sb.WriteString(v)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(sb.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateSignature checks the X-Twilio-Signature value against the auth token (Secret).
+// Twilio may sign the URL with or without the default port, so both variants are accepted.
+func (c *Client) ValidateSignature(rawURL string, params url.Values, signature string) bool {
+	if c.Secret == "" || signature == "" {
+		return false
+	}
+	for _, candidate := range urlVariants(rawURL) {
+		expected := ComputeSignature(c.Secret, candidate, params)
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlVariants returns rawURL plus the same URL with its default port added or removed
+func urlVariants(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return []string{rawURL}
+	}
+
+	defaultPort := map[string]string{"https": "443", "wss": "443", "http": "80", "ws": "80"}[u.Scheme]
+	if defaultPort == "" {
+		return []string{rawURL}
+	}
+
+	alt := *u
+	if u.Port() == "" {
+		alt.Host = u.Host + ":" + defaultPort
+	} else if u.Port() == defaultPort {
+		alt.Host = u.Hostname()
+	} else {
+		return []string{rawURL}
+	}
+	return []string{rawURL, alt.String()}
+}
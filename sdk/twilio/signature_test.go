@@ -0,0 +1,43 @@
+package twilio
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestComputeSignatureMatchesTwilioExample(t *testing.T) {
+	// Example from Twilio's webhook security documentation
+	params := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	got := ComputeSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", params)
+	if got != "0/KCTR6DLpKmkAf8muzZqo1nDgQ=" {
+		t.Fatalf("unexpected signature %q", got)
+	}
+}
+
+func TestValidateSignature(t *testing.T) {
+	c := &Client{Secret: "token"}
+	params := url.Values{"CallSid": {"CA123"}, "To": {"+15550001111"}}
+	sig := ComputeSignature("token", "https://example.com/incoming-call", params)
+
+	if !c.ValidateSignature("https://example.com/incoming-call", params, sig) {
+		t.Fatal("valid signature rejected")
+	}
+	if !c.ValidateSignature("https://example.com:443/incoming-call", params, sig) {
+		t.Fatal("signature rejected when URL carries the default port")
+	}
+	if c.ValidateSignature("https://example.com/incoming-call", url.Values{"CallSid": {"CA999"}}, sig) {
+		t.Fatal("signature accepted for tampered params")
+	}
+	if c.ValidateSignature("https://example.com/incoming-call", params, "") {
+		t.Fatal("missing signature accepted")
+	}
+	if (&Client{}).ValidateSignature("https://example.com/incoming-call", params, sig) {
+		t.Fatal("signature accepted without an auth token")
+	}
+}